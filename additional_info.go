@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// additionalInfoFields are the known fields of the usage detail additionalInfo
+// expanded by --expand-additional-info in this order.
+var additionalInfoFields = []struct {
+	name    string
+	integer bool
+}{
+	{name: "ServiceType"},
+	{name: "VMName"},
+	{name: "VMProperties"},
+	{name: "VCPUs", integer: true},
+	{name: "ImageType"},
+	{name: "UsageType"},
+	{name: "ConsumptionMeter"},
+	{name: "ReservationOrderId"},
+	{name: "ReservationId"},
+	{name: "DataCenter"},
+	{name: "NetworkBucket"},
+	{name: "PricingModel"},
+}
+
+// expandAdditionalInfo adds properties.additionalInfo.<name> columns of the known fields
+// parsed from the JSON string in properties.additionalInfo of the flattened map m.
+// All columns are added with nil for missing or malformed values so that
+// the CSV header is the same for all records.
+func expandAdditionalInfo(m map[string]interface{}) error {
+	info := map[string]interface{}{}
+	if s, ok := m["properties.additionalInfo"].(string); ok && s != "" {
+		dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+		dec.UseNumber()
+		var raw map[string]interface{}
+		if dec.Decode(&raw) == nil {
+			for key, val := range raw {
+				info[strings.ToLower(key)] = val
+			}
+		}
+	}
+	for _, f := range additionalInfoFields {
+		var v interface{}
+		switch val := info[strings.ToLower(f.name)].(type) {
+		case nil:
+		case json.Number:
+			if f.integer {
+				if i, err := val.Int64(); err == nil {
+					v = i
+				}
+			} else {
+				v = val.String()
+			}
+		case string:
+			if f.integer {
+				if i, err := json.Number(val).Int64(); err == nil {
+					v = i
+				}
+			} else {
+				v = val
+			}
+		default:
+			if !f.integer {
+				v = fmt.Sprint(val)
+			}
+		}
+		m["properties.additionalInfo."+f.name] = v
+	}
+	return nil
+}
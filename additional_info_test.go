@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestExpandAdditionalInfo(t *testing.T) {
+	tests := []struct {
+		s    interface{}
+		want map[string]interface{}
+	}{
+		{
+			s: `{"ServiceType":"Standard_D2s_v3","VCPUs":2,"ImageType":"Windows Server BYOL","UsageType":"ComputeHR"}`,
+			want: map[string]interface{}{
+				"ServiceType": "Standard_D2s_v3",
+				"VCPUs":       int64(2),
+				"ImageType":   "Windows Server BYOL",
+				"UsageType":   "ComputeHR",
+			},
+		},
+		{
+			s: `{"reservationOrderId":"order","ReservationId":"res","vcpus":"4","ConsumptionMeter":"meter"}`,
+			want: map[string]interface{}{
+				"ReservationOrderId": "order",
+				"ReservationId":      "res",
+				"VCPUs":              int64(4),
+				"ConsumptionMeter":   "meter",
+			},
+		},
+		{s: `{"VCPUs":"many","NetworkBucket":1}`, want: map[string]interface{}{"NetworkBucket": "1"}},
+		{s: `not json`, want: map[string]interface{}{}},
+		{s: "", want: map[string]interface{}{}},
+		{s: nil, want: map[string]interface{}{}},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			m := map[string]interface{}{}
+			if tt.s != nil {
+				m["properties.additionalInfo"] = tt.s
+			}
+			err := expandAdditionalInfo(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range additionalInfoFields {
+				key := "properties.additionalInfo." + f.name
+				got, ok := m[key]
+				if !ok {
+					t.Errorf("Column %q missing", key)
+				}
+				if want := tt.want[f.name]; got != want {
+					t.Errorf("Column %q mismatch want %#v got %#v", key, want, got)
+				}
+			}
+			if _, err := json.Marshal(m); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
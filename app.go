@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"reflect"
@@ -19,57 +22,100 @@ import (
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/spf13/cobra"
+	"github.com/yaegashi/azbill/expr"
+	"github.com/yaegashi/azbill/focus"
+	"github.com/yaegashi/azbill/identity"
 	"github.com/yaegashi/azbill/mapconv"
+	"github.com/yaegashi/azbill/schema"
 	"github.com/yaegashi/azbill/store"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
-	ProgressScale    = 100
-	ProgressColumn   = 50
-	defaultClientID  = "4a034c56-da44-48ce-90db-039a408974bd"
-	defaultTenantID  = "common"
-	environConfigDir = "AZBILL_CONFIG_DIR"
-	defaultConfigDir = "~/.azbill"
-	environAuth      = "AZBILL_AUTH"
-	defaultAuth      = "dev"
-	environAuthFile  = "AZBILL_AUTH_FILE"
-	defaultAuthFile  = "auth_file.json"
-	environAuthDev   = "AZBILL_AUTH_DEV"
-	defaultAuthDev   = "auth_dev.json"
-	environFormat    = "AZBILL_FORMAT"
-	defaultFormat    = "csv"
+	ProgressScale         = 100
+	ProgressColumn        = 50
+	authDevRetries        = 5
+	authDevFresh          = 5 * time.Minute
+	defaultClientID       = "4a034c56-da44-48ce-90db-039a408974bd"
+	defaultTenantID       = "common"
+	environConfigDir      = "AZBILL_CONFIG_DIR"
+	defaultConfigDir      = "~/.azbill"
+	environAuth           = "AZBILL_AUTH"
+	defaultAuth           = "dev"
+	environAuthFile       = "AZBILL_AUTH_FILE"
+	defaultAuthFile       = "auth_file.json"
+	environAuthDev        = "AZBILL_AUTH_DEV"
+	defaultAuthDev        = "auth_dev.json"
+	environSecretFile     = "AZBILL_SECRET_FILE"
+	defaultSecretFile     = "client_secret.txt"
+	environCertFile       = "AZBILL_CERT_FILE"
+	defaultCertFile       = "client_cert.pem"
+	environCertPass       = "AZBILL_CERT_PASSWORD"
+	environMSIEndpoint    = "AZBILL_MSI_ENDPOINT"
+	environFederatedToken = "AZBILL_FEDERATED_TOKEN"
+	environTokenKey       = "AZBILL_TOKEN_KEY"
+	environTokenKeyFile   = "AZBILL_TOKEN_KEY_FILE"
+	environCloud          = "AZBILL_CLOUD"
+	defaultCloud          = "public"
+	environFormat         = "AZBILL_FORMAT"
+	defaultFormat         = "csv"
 )
 
 type App struct {
-	Writer          io.WriteCloser
-	CSVWriter       *csv.Writer
-	MongoCli        *mongo.Client
-	MongoCol        *mongo.Collection
-	ConfigStore     *store.Store
-	Marshal         func(context.Context, interface{}, ...func(map[string]interface{}) error) error
-	Convert         func(interface{}, bool) (map[string]interface{}, error)
-	ConfigDir       string
-	Output          string
-	MongoURI        string
-	MongoDB         string
-	MongoCollection string
-	MongoDrop       bool
-	Auth            string
-	AuthDev         string
-	AuthFile        string
-	Client          string
-	Tenant          string
-	Format          string
-	Flatten         bool
-	Pretty          bool
-	IsStdout        bool
-	Quiet           bool
-	Records         int
-	Column          int
-	Keys            []string
-	StartTime       time.Time
+	Writer             io.WriteCloser
+	CSVWriter          *csv.Writer
+	MongoCli           *mongo.Client
+	MongoCol           *mongo.Collection
+	ConfigStore        *store.Store
+	Marshal            func(context.Context, interface{}, ...func(map[string]interface{}) error) error
+	Convert            func(interface{}, bool) (map[string]interface{}, error)
+	ConfigDir          string
+	Output             string
+	KeepPartial        bool
+	Compress           string
+	PartitionBy        string
+	MaxOpenFiles       int
+	MaxRows            int
+	MaxBytes           string
+	Manifest           string
+	IncludeColumns     string
+	ExcludeColumns     string
+	Columns            *columnSelector
+	SchemaMap          string
+	Schema             schema.Transform
+	WhereExpr          string
+	Where              *expr.Expr
+	Skipped            int
+	Partitioner        *partitioner
+	MongoURI           string
+	MongoDB            string
+	MongoCollection    string
+	MongoDrop          bool
+	Auth               string
+	AuthDev            string
+	AuthFile           string
+	SecretFile         string
+	CertFile           string
+	CertPassword       string
+	MSIClientID        string
+	FederatedTokenFile string
+	TokenKeyFile       string
+	StoreHeaders       []string
+	MSIEndpoint        string
+	Client             string
+	Cloud              string
+	Environment        azure.Environment
+	Tenant             string
+	Format             string
+	Flatten            bool
+	Pretty             bool
+	IsStdout           bool
+	Quiet              bool
+	Records            int
+	Column             int
+	Keys               []string
+	StartTime          time.Time
 }
 
 func (app *App) Cmd() *cobra.Command {
@@ -81,13 +127,31 @@ func (app *App) Cmd() *cobra.Command {
 		Version:           fmt.Sprintf("%s (%-0.7s)", version, commit),
 	}
 	cmd.PersistentFlags().StringVarP(&app.ConfigDir, "config-dir", "", "", envHelp("config dir", environConfigDir, defaultConfigDir))
+	cmd.PersistentFlags().StringVarP(&app.Cloud, "cloud", "", "", envHelp("Azure cloud [public,china,usgov]", environCloud, defaultCloud))
 	cmd.PersistentFlags().StringVarP(&app.Client, "client", "", "", envHelp("Azure client", auth.ClientID, defaultClientID))
 	cmd.PersistentFlags().StringVarP(&app.Tenant, "tenant", "", "", envHelp("Azure tenant", auth.TenantID, defaultTenantID))
-	cmd.PersistentFlags().StringVarP(&app.Auth, "auth", "", "", envHelp("auth source [dev,env,file,cli]", environAuth, defaultAuth))
+	cmd.PersistentFlags().StringVarP(&app.Auth, "auth", "", "", envHelp("auth source [dev,env,file,cli,msi,client-secret,client-cert,federated]", environAuth, defaultAuth))
 	cmd.PersistentFlags().StringVarP(&app.AuthFile, "auth-file", "", "", envHelp("auth file store", environAuthFile, defaultAuthFile))
 	cmd.PersistentFlags().StringVarP(&app.AuthDev, "auth-dev", "", "", envHelp("auth dev store", environAuthDev, defaultAuthDev))
-	cmd.PersistentFlags().StringVarP(&app.Format, "format", "", "", envHelp("output format [csv,json,flatten,pretty]", environFormat, defaultFormat))
-	cmd.PersistentFlags().StringVarP(&app.Output, "output", "o", "", "output file path")
+	cmd.PersistentFlags().StringVarP(&app.SecretFile, "secret-file", "", "", envHelp("client secret store for --auth client-secret", environSecretFile, defaultSecretFile))
+	cmd.PersistentFlags().StringVarP(&app.CertFile, "cert-file", "", "", envHelp("client certificate store (PEM or PFX) for --auth client-cert", environCertFile, defaultCertFile))
+	cmd.PersistentFlags().StringVarP(&app.FederatedTokenFile, "federated-token-file", "", "", envHelp("federated token file for --auth federated", identity.EnvironFederatedTokenFile, "$"+environFederatedToken))
+	cmd.PersistentFlags().StringVarP(&app.MSIClientID, "msi-client-id", "", "", "client ID of user-assigned managed identity for --auth msi")
+	cmd.PersistentFlags().StringVarP(&app.TokenKeyFile, "token-key-file", "", "", envHelp("passphrase file to encrypt auth-dev token", environTokenKeyFile, "$"+environTokenKey))
+	cmd.PersistentFlags().StringArrayVarP(&app.StoreHeaders, "store-header", "", nil, "header \"Name: value\" for requests to generic HTTP store locations (repeatable)")
+	cmd.PersistentFlags().StringVarP(&app.Format, "format", "", "", envHelp("output format [csv,json,flatten,pretty,focus]", environFormat, defaultFormat))
+	cmd.PersistentFlags().StringVarP(&app.IncludeColumns, "columns", "", "", "flattened columns to output in order, with glob patterns like properties.meterDetails.*")
+	cmd.PersistentFlags().StringVarP(&app.ExcludeColumns, "exclude-columns", "", "", "flattened columns not to output, with glob patterns")
+	cmd.PersistentFlags().StringVarP(&app.SchemaMap, "schema-map", "", "", fmt.Sprintf("schema map YAML file or built-in profile %v to rename and cast columns", append(schema.Builtins(), "focus")))
+	cmd.PersistentFlags().StringVarP(&app.WhereExpr, "where", "", "", "expression on flattened columns to select records like 'cost > 0 && properties.resourceGroup =~ \"^prod-\"'")
+	cmd.PersistentFlags().StringVarP(&app.Output, "output", "o", "", "output file path or Azure Blob Storage URL with SAS")
+	cmd.PersistentFlags().StringVarP(&app.Compress, "compress", "", "", "output compression [gzip,zstd,none] (default: by --output extension)")
+	cmd.PersistentFlags().StringVarP(&app.PartitionBy, "partition-by", "", "", "fields to partition output files by, with :year, :month or :day for dates")
+	cmd.PersistentFlags().IntVarP(&app.MaxOpenFiles, "max-open-files", "", 64, "max number of partitioned output files open at once")
+	cmd.PersistentFlags().IntVarP(&app.MaxRows, "max-rows", "", 0, "roll over output files every specified number of records")
+	cmd.PersistentFlags().StringVarP(&app.MaxBytes, "max-bytes", "", "", "roll over output files at specified size before compression like 500MB")
+	cmd.PersistentFlags().StringVarP(&app.Manifest, "manifest", "", "", "manifest file listing output files (default: name.manifest.json by --output with --max-rows or --max-bytes)")
+	cmd.PersistentFlags().BoolVarP(&app.KeepPartial, "keep-partial", "", false, "keep the partial output file with .partial suffix on failure")
 	cmd.PersistentFlags().StringVarP(&app.MongoURI, "mongo-uri", "", "", "output MongoDB URI")
 	cmd.PersistentFlags().StringVarP(&app.MongoDB, "mongo-db", "", "", "output MongoDB database")
 	cmd.PersistentFlags().StringVarP(&app.MongoCollection, "mongo-collection", "", "", "output MongoDB collection")
@@ -113,11 +177,29 @@ func envHelp(msg, env, def string) string {
 func (app *App) PersistentPreRunE(cmd *cobra.Command, args []string) error {
 	app.Client = envDefault(app.Client, auth.ClientID, defaultClientID)
 	app.Tenant = envDefault(app.Tenant, auth.TenantID, defaultTenantID)
+	app.Cloud = envDefault(app.Cloud, environCloud, defaultCloud)
 	app.ConfigDir = envDefault(app.ConfigDir, environConfigDir, defaultConfigDir)
 	app.Auth = envDefault(app.Auth, environAuth, defaultAuth)
 	app.AuthDev = envDefault(app.AuthDev, environAuthDev, defaultAuthDev)
 	app.AuthFile = envDefault(app.AuthFile, environAuthFile, defaultAuthFile)
 	app.Format = envDefault(app.Format, environFormat, defaultFormat)
+	app.SecretFile = envDefault(app.SecretFile, environSecretFile, defaultSecretFile)
+	app.CertFile = envDefault(app.CertFile, environCertFile, defaultCertFile)
+	app.CertPassword = envDefault(app.CertPassword, environCertPass, "")
+	app.TokenKeyFile = envDefault(app.TokenKeyFile, environTokenKeyFile, "")
+	app.FederatedTokenFile = envDefault(app.FederatedTokenFile, identity.EnvironFederatedTokenFile, "")
+	app.MSIEndpoint = envDefault(app.MSIEndpoint, environMSIEndpoint, "")
+
+	switch strings.ToLower(app.Cloud) {
+	case "public":
+		app.Environment = azure.PublicCloud
+	case "china":
+		app.Environment = azure.ChinaCloud
+	case "usgov":
+		app.Environment = azure.USGovernmentCloud
+	default:
+		return fmt.Errorf("unknown cloud: %s", app.Cloud)
+	}
 
 	store, err := store.NewStore(app.ConfigDir)
 	if err != nil {
@@ -125,8 +207,50 @@ func (app *App) PersistentPreRunE(cmd *cobra.Command, args []string) error {
 	}
 	app.ConfigStore = store
 
+	for _, h := range app.StoreHeaders {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return fmt.Errorf("invalid store header: %q", h)
+		}
+		if app.ConfigStore.HTTP.Header == nil {
+			app.ConfigStore.HTTP.Header = http.Header{}
+		}
+		app.ConfigStore.HTTP.Header.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	if app.TokenKeyFile != "" {
+		b, err := app.ConfigStore.ReadFile(app.TokenKeyFile)
+		if err != nil {
+			return err
+		}
+		b = bytes.TrimRight(b, "\r\n")
+		if len(b) == 0 {
+			return fmt.Errorf("empty token key in %s", app.TokenKeyFile)
+		}
+		app.ConfigStore.Passphrase = b
+	} else if key := os.Getenv(environTokenKey); key != "" {
+		app.ConfigStore.Passphrase = []byte(key)
+	}
+
 	app.IsStdout = app.MongoURI == "" && (app.Output == "" || app.Output == "-")
 
+	err = checkCompression(app.Compress)
+	if err != nil {
+		return err
+	}
+
+	app.Columns, err = parseColumns(app.IncludeColumns, app.ExcludeColumns)
+	if err != nil {
+		return err
+	}
+
+	if app.WhereExpr != "" {
+		app.Where, err = expr.Parse(app.WhereExpr)
+		if err != nil {
+			return fmt.Errorf("invalid --where: %w", err)
+		}
+	}
+
 	for _, f := range strings.Split(strings.ToLower(app.Format), ",") {
 		switch f {
 		case "json":
@@ -139,73 +263,236 @@ func (app *App) PersistentPreRunE(cmd *cobra.Command, args []string) error {
 		case "pretty":
 			app.Format = "json"
 			app.Pretty = true
+		case "focus":
+			app.SchemaMap = "focus"
 		default:
 			return fmt.Errorf("unknown format: %s", f)
 		}
 	}
+	if strings.EqualFold(app.Format, "focus") {
+		app.Format = "csv"
+	}
+
+	if app.SchemaMap == "focus" {
+		app.Schema = focus.Transform{}
+		app.Flatten = true
+	} else if app.SchemaMap != "" {
+		sm, ok := schema.Builtin(app.SchemaMap)
+		if !ok {
+			b, err := ioutil.ReadFile(app.SchemaMap)
+			if err != nil {
+				return err
+			}
+			sm, err = schema.Parse(b)
+			if err != nil {
+				return fmt.Errorf("%s: %w", app.SchemaMap, err)
+			}
+		}
+		app.Schema = sm
+		app.Flatten = true
+	}
 
 	return nil
 }
 
 func (app *App) Authorize() (autorest.Authorizer, error) {
+	return app.authorize(true)
+}
+
+// authorize returns the authorizer for --auth.  Unless prompt is set,
+// an unusable auth-dev token is reported as an error instead of starting the device flow.
+func (app *App) authorize(prompt bool) (autorest.Authorizer, error) {
 	switch app.Auth {
 	case "env":
-		return auth.NewAuthorizerFromEnvironment()
+		settings, err := auth.GetSettingsFromEnvironment()
+		if err != nil {
+			return nil, err
+		}
+		settings.Environment = app.Environment
+		settings.Values[auth.Resource] = app.Environment.ResourceManagerEndpoint
+		return settings.GetAuthorizer()
 	case "file":
 		loc, _ := app.ConfigStore.Location(app.AuthFile, true)
 		app.Logf("Loading auth-file config in %s", loc)
 		os.Setenv("AZURE_AUTH_LOCATION", app.AuthFile)
-		return auth.NewAuthorizerFromFile(azure.PublicCloud.ResourceManagerEndpoint)
+		return auth.NewAuthorizerFromFile(app.Environment.ResourceManagerEndpoint)
 	case "cli":
-		return auth.NewAuthorizerFromCLI()
-	case "dev":
-		loc, _ := app.ConfigStore.Location(app.AuthDev, true)
-		app.Logf("Loading auth-dev token in %s", loc)
-		b, err := app.ConfigStore.ReadFile(app.AuthDev)
+		return auth.NewAuthorizerFromCLIWithResource(app.Environment.ResourceManagerEndpoint)
+	case "msi":
+		mi := identity.NewManagedIdentity(app.MSIEndpoint, app.MSIClientID)
+		app.Logf("Requesting managed identity token from %s", mi.Endpoint)
+		token, err := mi.ServicePrincipalToken(app.Environment.ResourceManagerEndpoint)
 		if err != nil {
-			app.Logf("Warning: %s", err)
-			return app.AuthorizeDeviceFlow()
+			return nil, err
 		}
-		var token *adal.ServicePrincipalToken
-		err = json.Unmarshal(b, &token)
+		err = token.EnsureFresh()
 		if err != nil {
-			app.Logf("Warning: %s", err)
-			return app.AuthorizeDeviceFlow()
+			return nil, err
 		}
-		save := false
-		token.SetRefreshCallbacks([]adal.TokenRefreshCallback{func(adal.Token) error { save = true; return nil }})
-		err = token.EnsureFresh()
+		return autorest.NewBearerAuthorizer(token), nil
+	case "client-secret", "client-cert", "federated":
+		return app.AuthorizeServicePrincipal()
+	case "dev":
+		token, err := app.LoadAuthDev(app.Tenant)
 		if err != nil {
+			if !prompt {
+				return nil, err
+			}
 			app.Logf("Warning: %s", err)
 			return app.AuthorizeDeviceFlow()
 		}
-		if save {
-			b, err := json.Marshal(token)
-			if err == nil {
-				loc, _ := app.ConfigStore.Location(app.AuthDev, true)
-				app.Logf("Saving auth-dev token in %s", loc)
-				err = app.ConfigStore.WriteFile(app.AuthDev, b, 0600)
-			}
-			if err != nil {
-				app.Logf("Warning: %s", err)
-			}
-		}
 		return autorest.NewBearerAuthorizer(token), nil
 	}
 	return nil, fmt.Errorf("unknown auth: %s", app.Auth)
 }
 
+// AuthLocation describes where the credentials of --auth are loaded from.
+func (app *App) AuthLocation() string {
+	var loc string
+	switch app.Auth {
+	case "dev":
+		loc, _ = app.ConfigStore.Location(app.AuthDev, true)
+	case "file":
+		loc, _ = app.ConfigStore.Location(app.AuthFile, true)
+	case "client-secret":
+		loc, _ = app.ConfigStore.Location(app.SecretFile, true)
+	case "client-cert":
+		loc, _ = app.ConfigStore.Location(app.CertFile, true)
+	case "federated":
+		loc = app.FederatedTokenFile
+		if loc == "" {
+			loc = "$" + environFederatedToken
+		}
+	case "msi":
+		loc = identity.NewManagedIdentity(app.MSIEndpoint, app.MSIClientID).Endpoint
+	}
+	return loc
+}
+
+// AuthClaims authorizes without prompting and returns the claims of the access token.
+func (app *App) AuthClaims() (*identity.Claims, error) {
+	authorizer, err := app.authorize(false)
+	if err != nil {
+		return nil, err
+	}
+	ba, ok := authorizer.(*autorest.BearerAuthorizer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported authorizer %T", authorizer)
+	}
+	provider := ba.TokenProvider()
+	if r, ok := provider.(adal.Refresher); ok {
+		err = r.EnsureFresh()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return identity.ParseClaims(provider.OAuthToken())
+}
+
+// authDevKey returns the auth-dev token cache key for tenant.
+func (app *App) authDevKey(tenant string) string {
+	return identity.TokenCacheKey(app.Cloud, app.Client, tenant)
+}
+
+// ReadAuthDev reads the auth-dev token cache and its version in the store.
+func (app *App) ReadAuthDev() (*identity.TokenCache, string, error) {
+	b, version, err := app.ConfigStore.ReadFileVersion(app.AuthDev)
+	if err != nil {
+		return nil, "", err
+	}
+	cache, err := identity.ParseTokenCache(b, app.Cloud)
+	return cache, version, err
+}
+
+// WriteAuthDev writes the auth-dev token cache if the store is still at version.
+func (app *App) WriteAuthDev(cache *identity.TokenCache, version string) error {
+	b, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	loc, _ := app.ConfigStore.Location(app.AuthDev, true)
+	app.Logf("Saving auth-dev token in %s", loc)
+	return app.ConfigStore.WriteFileVersion(app.AuthDev, b, 0600, version)
+}
+
+// LoadAuthDev loads the auth-dev token for tenant and saves it back if refreshed.
+// Without a cached token for tenant, a refresh token cached for another tenant is redeemed.
+func (app *App) LoadAuthDev(tenant string) (*adal.ServicePrincipalToken, error) {
+	loc, _ := app.ConfigStore.Location(app.AuthDev, true)
+	app.Logf("Loading auth-dev token for tenant %s in %s", tenant, loc)
+	cache, version, err := app.ReadAuthDev()
+	if err != nil {
+		return nil, err
+	}
+	key := app.authDevKey(tenant)
+	token, ok := cache.Tokens[key]
+	if !ok {
+		rt := cache.RefreshToken(app.Cloud, app.Client)
+		if rt == "" {
+			return nil, fmt.Errorf("no auth-dev token for tenant %s", tenant)
+		}
+		app.Logf("Redeeming cached refresh token for tenant %s", tenant)
+		oauthConfig, err := adal.NewOAuthConfig(app.Environment.ActiveDirectoryEndpoint, tenant)
+		if err != nil {
+			return nil, err
+		}
+		token, err = adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, app.Client, app.Environment.ResourceManagerEndpoint, adal.Token{RefreshToken: rt})
+		if err != nil {
+			return nil, err
+		}
+	}
+	save := false
+	token.SetRefreshCallbacks([]adal.TokenRefreshCallback{func(adal.Token) error { save = true; return nil }})
+	err = token.EnsureFresh()
+	if err != nil {
+		return nil, err
+	}
+	if !save {
+		return token, nil
+	}
+	// Another process sharing the store may have refreshed the token meanwhile.
+	// Prefer its token if still fresh, otherwise merge ours into its cache.
+	for i := 0; ; i++ {
+		cache.Tokens[key] = token
+		err = app.WriteAuthDev(cache, version)
+		if err != store.ErrConflict || i >= authDevRetries {
+			break
+		}
+		app.Logf("Auth-dev token was updated by another process, reloading")
+		cache, version, err = app.ReadAuthDev()
+		if err != nil {
+			break
+		}
+		if t, ok := cache.Tokens[key]; ok && !t.Token().WillExpireIn(authDevFresh) {
+			return t, nil
+		}
+	}
+	if err != nil {
+		app.Logf("Warning: %s", err)
+	}
+	return token, nil
+}
+
 func (app *App) AuthorizeDeviceFlow() (autorest.Authorizer, error) {
 	deviceConfig := auth.NewDeviceFlowConfig(app.Client, app.Tenant)
+	deviceConfig.AADEndpoint = app.Environment.ActiveDirectoryEndpoint
+	deviceConfig.Resource = app.Environment.ResourceManagerEndpoint
 	token, err := deviceConfig.ServicePrincipalToken()
 	if err != nil {
 		return nil, err
 	}
-	b, err := json.Marshal(token)
-	if err == nil {
-		loc, _ := app.ConfigStore.Location(app.AuthDev, true)
-		app.Logf("Saving auth-dev token in %s", loc)
-		err = app.ConfigStore.WriteFile(app.AuthDev, b, 0600)
+	for i := 0; ; i++ {
+		var cache *identity.TokenCache
+		var version string
+		cache, version, err = app.ReadAuthDev()
+		if err != nil {
+			cache, version = identity.NewTokenCache(), ""
+		}
+		cache.Tokens[app.authDevKey(app.Tenant)] = token
+		err = app.WriteAuthDev(cache, version)
+		if err != store.ErrConflict || i >= authDevRetries {
+			break
+		}
 	}
 	if err != nil {
 		app.Logf("Warning: %s", err)
@@ -213,6 +500,67 @@ func (app *App) AuthorizeDeviceFlow() (autorest.Authorizer, error) {
 	return autorest.NewBearerAuthorizer(token), nil
 }
 
+func (app *App) AuthorizeServicePrincipal() (autorest.Authorizer, error) {
+	if app.Client == defaultClientID || app.Tenant == defaultTenantID {
+		return nil, fmt.Errorf("--auth %s requires --client and --tenant", app.Auth)
+	}
+	oauthConfig, err := adal.NewOAuthConfig(app.Environment.ActiveDirectoryEndpoint, app.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	resource := app.Environment.ResourceManagerEndpoint
+	var token *adal.ServicePrincipalToken
+	switch app.Auth {
+	case "client-secret":
+		loc, _ := app.ConfigStore.Location(app.SecretFile, true)
+		app.Logf("Loading client secret in %s", loc)
+		b, err := app.ConfigStore.ReadFile(app.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		token, err = adal.NewServicePrincipalToken(*oauthConfig, app.Client, strings.TrimSpace(string(b)), resource)
+		if err != nil {
+			return nil, err
+		}
+	case "client-cert":
+		loc, _ := app.ConfigStore.Location(app.CertFile, true)
+		app.Logf("Loading client certificate in %s", loc)
+		b, err := app.ConfigStore.ReadFile(app.CertFile)
+		if err != nil {
+			return nil, err
+		}
+		cert, key, err := identity.DecodeCertificate(b, app.CertPassword)
+		if err != nil {
+			return nil, err
+		}
+		token, err = adal.NewServicePrincipalTokenFromCertificate(*oauthConfig, app.Client, cert, key, resource)
+		if err != nil {
+			return nil, err
+		}
+	case "federated":
+		secret := &identity.FederatedSecret{TokenFile: app.FederatedTokenFile, Token: os.Getenv(environFederatedToken)}
+		if secret.TokenFile != "" {
+			app.Logf("Loading federated token in %s", secret.TokenFile)
+		} else {
+			app.Logf("Loading federated token in $%s", environFederatedToken)
+		}
+		token, err = adal.NewServicePrincipalTokenWithSecret(*oauthConfig, app.Client, resource, secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = token.EnsureFresh()
+	if err != nil {
+		return nil, err
+	}
+	return autorest.NewBearerAuthorizer(token), nil
+}
+
+// BaseURI returns the resource manager endpoint of the selected cloud for the API clients.
+func (app *App) BaseURI() string {
+	return strings.TrimSuffix(app.Environment.ResourceManagerEndpoint, "/")
+}
+
 func (app *App) Open(ctx context.Context) error {
 	if app.MongoURI != "" {
 		u, err := url.Parse(app.MongoURI)
@@ -225,6 +573,9 @@ func (app *App) Open(ctx context.Context) error {
 		if app.MongoDB == "" || app.MongoCollection == "" {
 			return fmt.Errorf("empty --mongo-db or --mongo-collection")
 		}
+		if app.PartitionBy != "" || app.MaxRows > 0 || app.MaxBytes != "" || app.Manifest != "" {
+			return fmt.Errorf("--partition-by, --max-rows, --max-bytes and --manifest conflict with --mongo-uri")
+		}
 		if u.User != nil {
 			user := u.User.Username()
 			if _, ok := u.User.Password(); ok {
@@ -266,17 +617,47 @@ func (app *App) Open(ctx context.Context) error {
 				format += ",pretty"
 			}
 		}
+		if app.Compress == "" {
+			app.Compress = compressionFor(app.Output)
+		}
+		if app.Compress != "none" {
+			format += "," + app.Compress
+		}
+		if app.PartitionBy != "" || app.MaxRows > 0 || app.MaxBytes != "" || app.Manifest != "" {
+			return app.openFiles(format)
+		}
 		if app.IsStdout {
-			app.Writer = os.Stdout
+			app.Writer = nopWriteCloser{os.Stdout}
 			app.Logf("Writing to stdout in %s", format)
+		} else if loc, isURL := app.ConfigStore.Location(app.Output, true); isURL {
+			app.Logf("Writing to blob %q in %s", loc, format)
+			u, err := url.Parse(app.Output)
+			if err != nil {
+				return err
+			}
+			w, err := app.ConfigStore.HTTP.NewBlobWriter(u)
+			if err != nil {
+				return err
+			}
+			app.Writer = w
 		} else {
 			app.Logf("Writing to file %q in %s", app.Output, format)
-			w, err := os.Create(app.Output)
+			w, err := createOutputFile(app.Output, app.KeepPartial)
 			if err != nil {
 				return err
 			}
 			app.Writer = w
 		}
+		w, err := newCompressWriter(app.Writer, app.Compress)
+		if err != nil {
+			if a, ok := app.Writer.(aborter); ok {
+				a.Abort()
+			} else {
+				app.Writer.Close()
+			}
+			return err
+		}
+		app.Writer = w
 		if app.Format == "csv" {
 			app.Marshal = app.CSVMarshal
 			app.CSVWriter = csv.NewWriter(app.Writer)
@@ -286,23 +667,102 @@ func (app *App) Open(ctx context.Context) error {
 			app.Marshal = app.JSONMarshal
 		}
 	}
+	app.start()
+	return nil
+}
+
+func (app *App) start() {
 	if app.Flatten {
 		app.Convert = mapconv.Flatten
 	} else {
 		app.Convert = mapconv.Nested
 	}
+	if app.Where != nil {
+		app.Marshal = app.whereMarshal(app.Marshal)
+	}
 	app.Keys = nil
 	app.Records = 0
+	app.Skipped = 0
 	app.StartTime = time.Now()
+}
+
+// openFiles sets up the output to files partitioned by --partition-by
+// and rolled over by --max-rows and --max-bytes.
+func (app *App) openFiles(format string) error {
+	if app.IsStdout {
+		return fmt.Errorf("--partition-by, --max-rows and --max-bytes require --output")
+	}
+	if _, isURL := app.ConfigStore.Location(app.Output, false); isURL {
+		return fmt.Errorf("--partition-by, --max-rows and --max-bytes support only file output")
+	}
+	if app.MaxOpenFiles < 1 {
+		return fmt.Errorf("--max-open-files should be positive")
+	}
+	if app.MaxRows < 0 {
+		return fmt.Errorf("--max-rows should not be negative")
+	}
+	p := &partitioner{
+		template:    app.Output,
+		format:      app.Format,
+		compress:    app.Compress,
+		keepPartial: app.KeepPartial,
+		maxOpen:     app.MaxOpenFiles,
+		maxRows:     app.MaxRows,
+		manifest:    app.Manifest,
+		marshal:     app.JSONMarshal,
+		files:       map[string]*partitionFile{},
+	}
+	if app.MaxBytes != "" {
+		n, err := parseSize(app.MaxBytes)
+		if err != nil {
+			return err
+		}
+		p.maxBytes = n
+	}
+	if app.PartitionBy != "" {
+		if !partitionPlaceholder.MatchString(app.Output) {
+			return fmt.Errorf("--output should contain placeholders like {subscriptionId} for --partition-by")
+		}
+		fields, err := parsePartitionBy(app.PartitionBy)
+		if err != nil {
+			return err
+		}
+		p.fields = fields
+		app.Logf("Writing to files %q partitioned by %s in %s", app.Output, app.PartitionBy, format)
+	} else {
+		app.Logf("Writing to files %q in %s", rotatedPath(app.Output, 1), format)
+	}
+	if p.manifest == "" && p.rotates() {
+		p.manifest = manifestPath(app.Output)
+	}
+	if app.Format == "csv" {
+		p.marshal = app.CSVMarshal
+	}
+	app.Partitioner = p
+	app.Marshal = app.PartitionMarshal
+	app.start()
 	return nil
 }
 
-func (app *App) Close(ctx context.Context) {
+// Close finishes the output opened by Open.  If err is not nil,
+// the output to file or blob is aborted without replacing the existing one.
+// It returns err, or the error on finishing the output.
+func (app *App) Close(ctx context.Context, err error) error {
 	if app.CSVWriter != nil {
 		app.CSVWriter.Flush()
+		if err == nil {
+			err = app.CSVWriter.Error()
+		}
+	}
+	if app.Partitioner != nil {
+		err = app.Partitioner.close(err)
 	}
-	if app.Writer != nil && !app.IsStdout {
-		app.Writer.Close()
+	if app.Writer != nil {
+		if a, ok := app.Writer.(aborter); ok && err != nil {
+			a.Abort()
+		} else if cerr := app.Writer.Close(); err == nil {
+			err = cerr
+		}
 	}
 	if app.MongoCol != nil {
 		app.MongoCli.Disconnect(ctx)
@@ -311,6 +771,10 @@ func (app *App) Close(ctx context.Context) {
 	endTime := time.Now()
 	d := endTime.Sub(app.StartTime)
 	app.Logf("Done %d records in %s, %f records/sec", app.Records, d, float64(app.Records)/d.Seconds())
+	if app.Where != nil || app.Skipped > 0 {
+		app.Logf("Skipped %d records by filters", app.Skipped)
+	}
+	return err
 }
 
 func (app *App) Progress(n int) {
@@ -354,6 +818,34 @@ func (app *App) JSONMarshal(ctx context.Context, v interface{}, mods ...func(map
 			return err
 		}
 	}
+	if app.Schema != nil || app.Columns != nil && app.Flatten {
+		var keys []string
+		if app.Schema != nil {
+			m, err = app.Schema.Apply(m)
+			if err != nil {
+				return err
+			}
+			keys = app.Schema.Keys()
+		} else {
+			for key := range m {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+		}
+		if app.Columns != nil {
+			keys = app.Columns.order(keys)
+			for key := range m {
+				if !app.Columns.match(key) {
+					delete(m, key)
+				}
+			}
+		}
+		if app.MongoCol == nil {
+			return app.writeOrdered(m, keys)
+		}
+	} else if app.Columns != nil {
+		app.Columns.prune(m, "", mapconv.FlattenNames(v))
+	}
 	if app.MongoCol != nil {
 		_, err = app.MongoCol.InsertOne(ctx, m)
 		if err != nil {
@@ -373,13 +865,70 @@ func (app *App) JSONMarshal(ctx context.Context, v interface{}, mods ...func(map
 	return nil
 }
 
+// whereMarshal returns marshal writing only the records whose flattened map
+// with mods applied satisfies --where.
+func (app *App) whereMarshal(marshal func(context.Context, interface{}, ...func(map[string]interface{}) error) error) func(context.Context, interface{}, ...func(map[string]interface{}) error) error {
+	return func(ctx context.Context, v interface{}, mods ...func(map[string]interface{}) error) error {
+		m, err := mapconv.Flatten(v, true)
+		if err != nil {
+			return err
+		}
+		for _, mod := range mods {
+			err = mod(m)
+			if err != nil {
+				return err
+			}
+		}
+		if !app.Where.Match(m) {
+			app.Skipped++
+			return nil
+		}
+		return marshal(ctx, v, mods...)
+	}
+}
+
+// writeOrdered writes the flat map m as a JSON object with keys in the order.
+func (app *App) writeOrdered(m map[string]interface{}, keys []string) error {
+	b, err := marshalOrdered(m, keys)
+	if err != nil {
+		return err
+	}
+	if app.Pretty {
+		var buf bytes.Buffer
+		err = json.Indent(&buf, b, "", "  ")
+		if err != nil {
+			return err
+		}
+		b = buf.Bytes()
+	}
+	_, err = app.Writer.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+	app.Progress(1)
+	return nil
+}
+
 func (app *App) CSVMarshal(ctx context.Context, v interface{}, mods ...func(map[string]interface{}) error) error {
 	if app.Keys == nil {
 		m, _ := mapconv.Flatten(v, false)
-		for key := range m {
-			app.Keys = append(app.Keys, key)
+		for _, mod := range mods {
+			err := mod(m)
+			if err != nil {
+				return err
+			}
+		}
+		if app.Schema != nil {
+			app.Keys = app.Schema.Keys()
+		} else {
+			for key := range m {
+				app.Keys = append(app.Keys, key)
+			}
+			sort.Strings(app.Keys)
+		}
+		if app.Columns != nil {
+			app.Keys = app.Columns.order(app.Keys)
 		}
-		sort.Strings(app.Keys)
 		err := app.CSVWriter.Write(app.Keys)
 		if err != nil {
 			return err
@@ -396,9 +945,15 @@ func (app *App) CSVMarshal(ctx context.Context, v interface{}, mods ...func(map[
 			return err
 		}
 	}
+	if app.Schema != nil {
+		m, err = app.Schema.Apply(m)
+		if err != nil {
+			return err
+		}
+	}
 	for _, key := range app.Keys {
 		col := ""
-		if val, ok := m[key]; ok {
+		if val, ok := m[key]; ok && val != nil {
 			rv := reflect.ValueOf(val)
 			switch rv.Kind() {
 			case reflect.Slice, reflect.Map:
@@ -27,14 +27,14 @@ func (app *AppAccounts) Cmd() *cobra.Command {
 	return cmd
 }
 
-func (app *AppAccounts) RunE(cmd *cobra.Command, args []string) error {
+func (app *AppAccounts) RunE(cmd *cobra.Command, args []string) (err error) {
 	authorizer, err := app.Authorize()
 	if err != nil {
 		return err
 	}
 
 	ctx := context.Background()
-	accountsClient := billing.NewAccountsClient("")
+	accountsClient := billing.NewAccountsClientWithBaseURI(app.BaseURI(), "")
 	accountsClient.Authorizer = authorizer
 
 	app.Logf("Requesting with %T", accountsClient)
@@ -48,7 +48,7 @@ func (app *AppAccounts) RunE(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	defer app.Close(ctx)
+	defer func() { err = app.Close(ctx, err) }()
 
 	for r.NotDone() {
 		type account billing.Account
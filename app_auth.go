@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+type AppAuth struct {
+	*App
+}
+
+func (app *App) AppAuthCmder() cmder.Cmder {
+	return &AppAuth{App: app}
+}
+
+func (app *AppAuth) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "auth",
+		Short:        "Auth commands",
+		SilenceUsage: true,
+	}
+	return cmd
+}
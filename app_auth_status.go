@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+type AppAuthStatus struct {
+	*AppAuth
+}
+
+func (app *AppAuth) AppAuthStatusCmder() cmder.Cmder {
+	return &AppAuthStatus{AppAuth: app}
+}
+
+func (app *AppAuthStatus) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "status",
+		Short:        "Show the auth source and whether it is valid",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	return cmd
+}
+
+func (app *AppAuthStatus) RunE(cmd *cobra.Command, args []string) (err error) {
+	type status struct {
+		Auth      string `json:"auth"`
+		Location  string `json:"location"`
+		Valid     bool   `json:"valid"`
+		Error     string `json:"error"`
+		TenantID  string `json:"tenantId"`
+		Name      string `json:"name"`
+		ExpiresOn string `json:"expiresOn"`
+	}
+	st := status{Auth: app.Auth, Location: app.AuthLocation()}
+	claims, err := app.AuthClaims()
+	if err != nil {
+		st.Error = err.Error()
+	} else {
+		st.Valid = true
+		st.TenantID = claims.TenantID
+		st.Name = claims.Name()
+		st.ExpiresOn = claims.Expires().Format(time.RFC3339)
+	}
+
+	ctx := context.Background()
+	err = app.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { err = app.Close(ctx, err) }()
+
+	return app.Marshal(ctx, st)
+}
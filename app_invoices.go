@@ -35,14 +35,14 @@ func (app *AppInvoices) Cmd() *cobra.Command {
 	return cmd
 }
 
-func (app *AppInvoices) RunE(cmd *cobra.Command, args []string) error {
+func (app *AppInvoices) RunE(cmd *cobra.Command, args []string) (err error) {
 	authorizer, err := app.Authorize()
 	if err != nil {
 		return err
 	}
 
 	ctx := context.Background()
-	invoicesClient := billing.NewInvoicesClient(app.Subscription)
+	invoicesClient := billing.NewInvoicesClientWithBaseURI(app.BaseURI(), app.Subscription)
 	invoicesClient.Authorizer = authorizer
 
 	app.Logf("Requesting with %T", invoicesClient)
@@ -67,7 +67,7 @@ func (app *AppInvoices) RunE(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	defer app.Close(ctx)
+	defer func() { err = app.Close(ctx, err) }()
 
 	for r.NotDone() {
 		type invoice billing.Invoice
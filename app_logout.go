@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+type AppLogout struct {
+	*App
+	All bool
+}
+
+func (app *App) AppLogoutCmder() cmder.Cmder {
+	return &AppLogout{App: app}
+}
+
+func (app *AppLogout) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "logout",
+		Short:        "Delete auth-dev token",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	cmd.Flags().BoolVarP(&app.All, "all", "", false, "delete tokens of all tenants")
+	return cmd
+}
+
+func (app *AppLogout) RunE(cmd *cobra.Command, args []string) error {
+	loc, _ := app.ConfigStore.Location(app.AuthDev, true)
+	cache, version, err := app.ReadAuthDev()
+	if os.IsNotExist(err) {
+		app.Logf("No auth-dev token in %s", loc)
+		return nil
+	}
+	if err != nil && !app.All {
+		return fmt.Errorf("%w; use --all to delete the auth-dev store of all tenants", err)
+	}
+	if !app.All {
+		key := app.authDevKey(app.Tenant)
+		if _, ok := cache.Tokens[key]; !ok {
+			app.Logf("No auth-dev token for tenant %s in %s", app.Tenant, loc)
+			return nil
+		}
+		delete(cache.Tokens, key)
+		if len(cache.Tokens) > 0 {
+			app.Logf("Deleting auth-dev token for tenant %s in %s", app.Tenant, loc)
+			return app.WriteAuthDev(cache, version)
+		}
+	}
+	err = app.ConfigStore.RemoveFile(app.AuthDev)
+	if err != nil {
+		return err
+	}
+	app.Logf("Deleted auth-dev token in %s", loc)
+	return nil
+}
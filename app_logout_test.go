@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yaegashi/azbill/store"
+)
+
+func TestLogoutUnreadable(t *testing.T) {
+	tests := []struct {
+		b   string
+		all bool
+		ok  bool
+	}{
+		{b: "not json", all: false, ok: false},
+		{b: "AZBILL-ENC1\nencrypted", all: false, ok: false},
+		{b: "not json", all: true, ok: true},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			dir := tempDir(t)
+			s, err := store.NewStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, defaultAuthDev)
+			err = ioutil.WriteFile(path, []byte(tt.b), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			app := &AppLogout{App: &App{ConfigStore: s, AuthDev: defaultAuthDev, Cloud: "public", Client: "client", Tenant: "common", Quiet: true}, All: tt.all}
+			err = app.RunE(nil, nil)
+			if tt.ok != (err == nil) {
+				t.Errorf("Error mismatch want ok=%v got %v", tt.ok, err)
+			}
+			if _, serr := os.Stat(path); tt.ok != os.IsNotExist(serr) {
+				t.Errorf("Store removal mismatch want %v got %v", tt.ok, serr)
+			}
+		})
+	}
+}
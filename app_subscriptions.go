@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2019-06-01/subscriptions"
+	"github.com/Azure/go-autorest/autorest"
 	"github.com/spf13/cobra"
 	cmder "github.com/yaegashi/cobra-cmder"
 )
@@ -13,6 +14,7 @@ type AppSubscriptions struct {
 	StartDate      string
 	EndDate        string
 	BillingAccount string
+	AllTenants     bool
 }
 
 func (app *App) AppSubscriptionsCmder() cmder.Cmder {
@@ -27,35 +29,66 @@ func (app *AppSubscriptions) Cmd() *cobra.Command {
 		RunE:         app.RunE,
 		SilenceUsage: true,
 	}
+	cmd.Flags().BoolVarP(&app.AllTenants, "all-tenants", "", false, "list subscriptions in all tenants")
 	return cmd
 }
 
-func (app *AppSubscriptions) RunE(cmd *cobra.Command, args []string) error {
+func (app *AppSubscriptions) RunE(cmd *cobra.Command, args []string) (err error) {
+	if app.AllTenants {
+		err = app.CheckTenantAuth()
+		if err != nil {
+			return err
+		}
+	}
+
 	authorizer, err := app.Authorize()
 	if err != nil {
 		return err
 	}
 
 	ctx := context.Background()
-	subscriptionsClient := subscriptions.NewClient()
-	subscriptionsClient.Authorizer = authorizer
+	if !app.AllTenants {
+		subscriptionsClient := subscriptions.NewClientWithBaseURI(app.BaseURI())
+		subscriptionsClient.Authorizer = authorizer
 
-	app.Logf("Requesting with %T", subscriptionsClient)
+		app.Logf("Requesting with %T", subscriptionsClient)
 
-	r, err := subscriptionsClient.ListComplete(ctx)
-	if err != nil {
-		return err
+		var r subscriptions.ListResultIterator
+		r, err = subscriptionsClient.ListComplete(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = app.Open(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() { err = app.Close(ctx, err) }()
+
+		return app.marshalSubscriptions(ctx, r)
 	}
 
 	err = app.Open(ctx)
 	if err != nil {
 		return err
 	}
-	defer app.Close(ctx)
+	defer func() { err = app.Close(ctx, err) }()
+
+	return app.ForEachTenant(ctx, authorizer, func(tenant string, authorizer autorest.Authorizer) error {
+		subscriptionsClient := subscriptions.NewClientWithBaseURI(app.BaseURI())
+		subscriptionsClient.Authorizer = authorizer
+		r, err := subscriptionsClient.ListComplete(ctx)
+		if err != nil {
+			return err
+		}
+		return app.marshalSubscriptions(ctx, r, tenantMod(tenant))
+	})
+}
 
+func (app *AppSubscriptions) marshalSubscriptions(ctx context.Context, r subscriptions.ListResultIterator, mods ...func(map[string]interface{}) error) error {
 	for r.NotDone() {
 		type subscription subscriptions.Subscription
-		err = app.Marshal(ctx, subscription(r.Value()))
+		err := app.Marshal(ctx, subscription(r.Value()), mods...)
 		if err != nil {
 			return err
 		}
@@ -30,14 +30,14 @@ func (app *AppTenants) Cmd() *cobra.Command {
 	return cmd
 }
 
-func (app *AppTenants) RunE(cmd *cobra.Command, args []string) error {
+func (app *AppTenants) RunE(cmd *cobra.Command, args []string) (err error) {
 	authorizer, err := app.Authorize()
 	if err != nil {
 		return err
 	}
 
 	ctx := context.Background()
-	tenantsClient := subscriptions.NewTenantsClient()
+	tenantsClient := subscriptions.NewTenantsClientWithBaseURI(app.BaseURI())
 	tenantsClient.Authorizer = authorizer
 
 	app.Logf("Requesting with %T", tenantsClient)
@@ -51,7 +51,7 @@ func (app *AppTenants) RunE(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	defer app.Close(ctx)
+	defer func() { err = app.Close(ctx, err) }()
 
 	for r.NotDone() {
 		type tenant subscriptions.TenantIDDescription
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCloud(t *testing.T) {
+	old, ok := os.LookupEnv(environCloud)
+	os.Unsetenv(environCloud)
+	if ok {
+		defer os.Setenv(environCloud, old)
+	}
+	tests := []struct {
+		c, b, e string
+	}{
+		{c: "", b: "https://management.azure.com"},
+		{c: "public", b: "https://management.azure.com"},
+		{c: "China", b: "https://management.chinacloudapi.cn"},
+		{c: "USGOV", b: "https://management.usgovcloudapi.net"},
+		{c: "germany", e: "unknown cloud: germany"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			app := &App{Cloud: tt.c, ConfigDir: tempDir(t)}
+			err := app.PersistentPreRunE(nil, nil)
+			if tt.e != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.e) {
+					t.Errorf("Error mismatch want %q got %v", tt.e, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := app.BaseURI(); b != tt.b {
+				t.Errorf("BaseURI mismatch want %q got %q", tt.b, b)
+			}
+		})
+	}
+}
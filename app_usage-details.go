@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"path/filepath"
 
 	"github.com/Azure/azure-sdk-for-go/services/consumption/mgmt/2019-10-01/consumption"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2019-06-01/subscriptions"
+	"github.com/Azure/go-autorest/autorest"
 	"github.com/spf13/cobra"
+	"github.com/yaegashi/azbill/focus"
 	cmder "github.com/yaegashi/cobra-cmder"
 )
 
@@ -17,8 +19,23 @@ type AppUsageDetails struct {
 	BillingAccount string
 	BillingPeriod  string
 	Subscription   string
+	ResourceGroup  string
 	StartDate      string
 	EndDate        string
+	AllTenants     bool
+
+	FilterResourceGroups  []string
+	FilterTags            []string
+	FilterMeterCategories []string
+	FilterChargeTypes     []string
+	ODataFilter           string
+	ExpandTags            bool
+	TagColumns            []string
+	ExpandAdditionalInfo  bool
+	ParseResourceID       bool
+	Amortize              bool
+
+	tags *tagExpander
 }
 
 func (app *App) AppUsageDetailsCmder() cmder.Cmder {
@@ -37,12 +54,92 @@ func (app *AppUsageDetails) Cmd() *cobra.Command {
 	cmd.Flags().StringVarP(&app.BillingAccount, "billing-account", "A", "", "billing account")
 	cmd.Flags().StringVarP(&app.BillingPeriod, "billing-period", "P", "", "billing period")
 	cmd.Flags().StringVarP(&app.Subscription, "subscription", "S", "", "subscription")
+	cmd.Flags().StringVarP(&app.ResourceGroup, "resource-group", "G", "", "resource group (requires --subscription)")
 	cmd.Flags().StringVarP(&app.StartDate, "start", "", "", "start date (YYYY-MM-DD)")
 	cmd.Flags().StringVarP(&app.EndDate, "end", "", "", "end date (YYYY-MM-DD)")
+	cmd.Flags().StringSliceVarP(&app.FilterResourceGroups, "filter-resource-group", "", nil, "filter by resource groups")
+	cmd.Flags().StringArrayVarP(&app.FilterTags, "filter-tag", "", nil, "filter by tag key=value (repeatable)")
+	cmd.Flags().StringSliceVarP(&app.FilterMeterCategories, "filter-meter-category", "", nil, "filter by meter categories")
+	cmd.Flags().StringSliceVarP(&app.FilterChargeTypes, "filter-charge-type", "", nil, "filter by charge types like Usage,Purchase")
+	cmd.Flags().StringVarP(&app.ODataFilter, "odata-filter", "", "", "raw OData $filter expression added to the filters")
+	cmd.Flags().BoolVarP(&app.ExpandTags, "expand-tags", "", false, "expand all tags into tags.<key> columns in flatten format")
+	cmd.Flags().StringSliceVarP(&app.TagColumns, "tag-columns", "", nil, "expand tags into tags.<key> columns like env,costCenter in flatten or csv format")
+	cmd.Flags().BoolVarP(&app.ExpandAdditionalInfo, "expand-additional-info", "", false, "expand known additionalInfo fields into properties.additionalInfo.<name> columns in flatten or csv format")
+	cmd.Flags().BoolVarP(&app.ParseResourceID, "parse-resource-id", "", false, "decompose resource IDs into resource.<part> columns in flatten or csv format")
+	cmd.Flags().BoolVarP(&app.Amortize, "amortize", "", false, "list amortized costs spreading reservation and savings plan purchases over their terms")
+	cmd.Flags().BoolVarP(&app.AllTenants, "all-tenants", "", false, "list usage details of all subscriptions in all tenants")
 	return cmd
 }
 
-func (app *AppUsageDetails) RunE(cmd *cobra.Command, args []string) error {
+// buildScope composes the usage details scope from --scope and the scope flags.
+func (app *AppUsageDetails) buildScope() (string, error) {
+	elem := []string{app.Scope}
+	for _, f := range []struct{ flag, val, prefix string }{
+		{"--billing-account", app.BillingAccount, "providers/Microsoft.Billing/billingAccounts"},
+		{"--subscription", app.Subscription, "subscriptions"},
+		{"--resource-group", app.ResourceGroup, "resourceGroups"},
+		{"--billing-period", app.BillingPeriod, "providers/Microsoft.Billing/billingPeriods"},
+	} {
+		if f.val == "" {
+			continue
+		}
+		err := scopeSegment(f.flag, f.val)
+		if err != nil {
+			return "", err
+		}
+		elem = append(elem, f.prefix, f.val)
+	}
+	if app.ResourceGroup != "" && app.Subscription == "" {
+		return "", fmt.Errorf("--resource-group requires --subscription")
+	}
+	scope, err := joinScope(elem...)
+	if err != nil {
+		return "", err
+	}
+	if scope == "" {
+		return "", fmt.Errorf("no scope specified")
+	}
+	return validateScope(scope)
+}
+
+func (app *AppUsageDetails) RunE(cmd *cobra.Command, args []string) (err error) {
+	var scope string
+	filter, filters, err := app.buildFilter()
+	if err != nil {
+		return err
+	}
+	if app.ExpandTags && app.Format == "csv" {
+		return fmt.Errorf("--expand-tags can't fix the csv header; use --tag-columns instead")
+	}
+	if (app.ExpandTags || len(app.TagColumns) > 0) && app.Format != "csv" && !app.Flatten {
+		return fmt.Errorf("--expand-tags and --tag-columns require flatten or csv format")
+	}
+	if app.ExpandAdditionalInfo && app.Format != "csv" && !app.Flatten {
+		return fmt.Errorf("--expand-additional-info requires flatten or csv format; json already has additionalInfo as an object")
+	}
+	if app.ParseResourceID && app.Format != "csv" && !app.Flatten {
+		return fmt.Errorf("--parse-resource-id requires flatten or csv format")
+	}
+	app.tags = newTagExpander(app.TagColumns, app.ExpandTags)
+	if tr, ok := app.Schema.(focus.Transform); ok {
+		tr.Amortized = app.Amortize
+		app.Schema = tr
+	}
+	if app.AllTenants {
+		if app.Scope != "" || app.BillingAccount != "" || app.Subscription != "" || app.ResourceGroup != "" {
+			return fmt.Errorf("--all-tenants conflicts with --scope, --billing-account, --subscription and --resource-group")
+		}
+		err = app.CheckTenantAuth()
+		if err != nil {
+			return err
+		}
+	} else {
+		scope, err = app.buildScope()
+		if err != nil {
+			return err
+		}
+	}
+
 	authorizer, err := app.Authorize()
 	if err != nil {
 		return err
@@ -53,36 +150,65 @@ func (app *AppUsageDetails) RunE(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	defer app.Close(ctx)
-
-	usageDetailsClient := consumption.NewUsageDetailsClient("")
-	usageDetailsClient.Authorizer = authorizer
+	defer func() { err = app.Close(ctx, err) }()
 
-	scope := app.Scope
-	if app.BillingAccount != "" {
-		scope = filepath.Join(scope, "providers/Microsoft.Billing/billingAccounts", app.BillingAccount)
-	}
-	if app.Subscription != "" {
-		scope = filepath.Join(scope, "subscriptions", app.Subscription)
-	}
-	if app.BillingPeriod != "" {
-		scope = filepath.Join(scope, "providers/Microsoft.Billing/billingPeriods", app.BillingPeriod)
-	}
-	if scope == "" {
-		return fmt.Errorf("no scope specified")
+	if !app.AllTenants {
+		return app.export(ctx, authorizer, scope, filter, filters)
 	}
 
+	return app.ForEachTenant(ctx, authorizer, func(tenant string, authorizer autorest.Authorizer) error {
+		subscriptionsClient := subscriptions.NewClientWithBaseURI(app.BaseURI())
+		subscriptionsClient.Authorizer = authorizer
+		r, err := subscriptionsClient.ListComplete(ctx)
+		if err != nil {
+			return err
+		}
+		for r.NotDone() {
+			if id := r.Value().SubscriptionID; id != nil {
+				app.Subscription = *id
+				scope, err := app.buildScope()
+				if err != nil {
+					return err
+				}
+				err = app.export(ctx, authorizer, scope, filter, filters, tenantMod(tenant))
+				if err != nil {
+					return err
+				}
+			}
+			err = r.NextWithContext(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// export writes the usage details in scope selected by filter and filters
+// with mods applied after the default ones.
+func (app *AppUsageDetails) export(ctx context.Context, authorizer autorest.Authorizer, scope, filter string, filters []usageFilter, mods ...func(map[string]interface{}) error) error {
+	usageDetailsClient := consumption.NewUsageDetailsClientWithBaseURI(app.BaseURI(), "")
+	usageDetailsClient.Authorizer = authorizer
+
 	expand := "properties/additionalInfo,properties/meterDetails"
-	filter := ""
-	if app.StartDate != "" && app.EndDate != "" {
-		filter = fmt.Sprintf("properties/usageStart eq '%s' and properties/usageEnd eq '%s'", app.StartDate, app.EndDate)
+	// The API amortizes purchases and adds UnusedReservation charges with the metric,
+	// which is more accurate than amortizing reservationId, term and frequency here.
+	var metric consumption.Metrictype
+	if app.Amortize {
+		metric = consumption.AmortizedCostMetricType
 	}
 
 	app.Logf("Requesting with %T", usageDetailsClient)
 	app.Logf("   scope: %q", scope)
 	app.Logf("  filter: %q", filter)
+	if metric != "" {
+		app.Logf("  metric: %q", metric)
+	}
+	if len(filters) > 0 {
+		app.Logf("  %d more filters on client side", len(filters))
+	}
 
-	r, err := usageDetailsClient.ListComplete(ctx, scope, expand, filter, "", nil, "")
+	r, err := usageDetailsClient.ListComplete(ctx, scope, expand, filter, "", nil, metric)
 	if err != nil {
 		return err
 	}
@@ -114,17 +240,36 @@ func (app *AppUsageDetails) RunE(cmd *cobra.Command, args []string) error {
 			return nil
 		}
 	}
+	mods = append([]func(map[string]interface{}) error{mod}, mods...)
+	if app.ParseResourceID {
+		mods = append([]func(map[string]interface{}) error{parseResourceIDMod}, mods...)
+	}
+	if app.ExpandAdditionalInfo {
+		mods = append([]func(map[string]interface{}) error{expandAdditionalInfo}, mods...)
+	}
+	if app.tags != nil {
+		mods = append([]func(map[string]interface{}) error{app.tags.mod}, mods...)
+	}
 
+	type LegacyUsageDetail consumption.LegacyUsageDetail
+	type ModernUsageDetail consumption.ModernUsageDetail
 	for r.NotDone() {
+		var v interface{}
 		x := r.Value()
-		if v, ok := x.AsLegacyUsageDetail(); ok {
-			type LegacyUsageDetail consumption.LegacyUsageDetail
-			err = app.Marshal(ctx, (*LegacyUsageDetail)(v), mod)
+		if u, ok := x.AsLegacyUsageDetail(); ok {
+			v = (*LegacyUsageDetail)(u)
+		} else if u, ok := x.AsModernUsageDetail(); ok {
+			v = (*ModernUsageDetail)(u)
+		} else {
+			return fmt.Errorf("unexpected type %T", x)
+		}
+		if matchFilters(v, filters) {
+			err = app.Marshal(ctx, v, mods...)
 			if err != nil {
 				return err
 			}
 		} else {
-			return fmt.Errorf("unexpected type %T", x)
+			app.Skipped++
 		}
 		err = r.NextWithContext(ctx)
 		if err != nil {
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+func TestExportQuery(t *testing.T) {
+	tests := []struct {
+		app    AppUsageDetails
+		metric string
+		filter string
+	}{
+		{app: AppUsageDetails{}, metric: "", filter: ""},
+		{app: AppUsageDetails{Amortize: true}, metric: "amortizedcost", filter: ""},
+		{app: AppUsageDetails{Amortize: true, FilterChargeTypes: []string{"Purchase"}}, metric: "amortizedcost", filter: "properties/chargeType eq 'Purchase'"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			var query url.Values
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query()
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"value":[{"kind":"legacy","id":"u1","properties":{"chargeType":"Purchase"}}]}`)
+			}))
+			defer ts.Close()
+			records := 0
+			app := tt.app
+			app.App = &App{Quiet: true}
+			app.Environment.ResourceManagerEndpoint = ts.URL
+			app.Marshal = func(ctx context.Context, v interface{}, mods ...func(map[string]interface{}) error) error {
+				records++
+				return nil
+			}
+			filter, filters, err := app.buildFilter()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.export(context.Background(), autorest.NullAuthorizer{}, "subscriptions/sub", filter, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if records != 1 {
+				t.Errorf("Records mismatch want 1 got %d", records)
+			}
+			if got := query.Get("metric"); got != tt.metric {
+				t.Errorf("Metric mismatch want %q got %q", tt.metric, got)
+			}
+			if got := query.Get("$filter"); got != tt.filter {
+				t.Errorf("Filter mismatch want %q got %q", tt.filter, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+	cmder "github.com/yaegashi/cobra-cmder"
+)
+
+type AppWhoami struct {
+	*App
+}
+
+func (app *App) AppWhoamiCmder() cmder.Cmder {
+	return &AppWhoami{App: app}
+}
+
+func (app *AppWhoami) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "whoami",
+		Short:        "Show the identity of the auth token",
+		RunE:         app.RunE,
+		SilenceUsage: true,
+	}
+	return cmd
+}
+
+func (app *AppWhoami) RunE(cmd *cobra.Command, args []string) (err error) {
+	claims, err := app.AuthClaims()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	err = app.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { err = app.Close(ctx, err) }()
+
+	type whoami struct {
+		Auth      string   `json:"auth"`
+		TenantID  string   `json:"tenantId"`
+		Name      string   `json:"name"`
+		ObjectID  string   `json:"objectId"`
+		AppID     string   `json:"appId"`
+		Scopes    string   `json:"scopes"`
+		Roles     []string `json:"roles"`
+		ExpiresOn string   `json:"expiresOn"`
+	}
+	return app.Marshal(ctx, whoami{
+		Auth:      app.Auth,
+		TenantID:  claims.TenantID,
+		Name:      claims.Name(),
+		ObjectID:  claims.ObjectID,
+		AppID:     claims.AppID,
+		Scopes:    claims.Scope,
+		Roles:     claims.Roles,
+		ExpiresOn: claims.Expires().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// columnSelector selects and orders flattened keys by glob patterns
+// given by --columns and --exclude-columns.
+type columnSelector struct {
+	include []string
+	exclude []string
+}
+
+// parseColumns parses patterns separated by commas.  It returns nil if both are empty.
+func parseColumns(include, exclude string) (*columnSelector, error) {
+	if include == "" && exclude == "" {
+		return nil, nil
+	}
+	cs := &columnSelector{}
+	for _, p := range []struct {
+		flag, val string
+		dst       *[]string
+	}{
+		{"--columns", include, &cs.include},
+		{"--exclude-columns", exclude, &cs.exclude},
+	} {
+		if p.val == "" {
+			continue
+		}
+		for _, pat := range strings.Split(p.val, ",") {
+			pat = strings.TrimSpace(pat)
+			if pat == "" {
+				return nil, fmt.Errorf("empty column in %s", p.flag)
+			}
+			if _, err := path.Match(pat, ""); err != nil {
+				return nil, fmt.Errorf("invalid column pattern %q in %s", pat, p.flag)
+			}
+			*p.dst = append(*p.dst, pat)
+		}
+	}
+	return cs, nil
+}
+
+func matchAny(patterns []string, key string) bool {
+	for _, pat := range patterns {
+		if ok, _ := path.Match(pat, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isLiteral(pat string) bool {
+	return !strings.ContainsAny(pat, `*?[\`)
+}
+
+// match reports whether key is selected.
+func (cs *columnSelector) match(key string) bool {
+	if len(cs.include) > 0 && !matchAny(cs.include, key) {
+		return false
+	}
+	return !matchAny(cs.exclude, key)
+}
+
+// order returns the selected keys in the order of the patterns of --columns,
+// in the order of keys among the keys matched by the same pattern.
+// Literal column names are always returned even if not in keys.
+func (cs *columnSelector) order(keys []string) []string {
+	if len(cs.include) == 0 {
+		out := []string{}
+		for _, key := range keys {
+			if cs.match(key) {
+				out = append(out, key)
+			}
+		}
+		return out
+	}
+	out := []string{}
+	seen := map[string]bool{}
+	for _, pat := range cs.include {
+		if isLiteral(pat) {
+			if !seen[pat] && !matchAny(cs.exclude, pat) {
+				seen[pat] = true
+				out = append(out, pat)
+			}
+			continue
+		}
+		for _, key := range keys {
+			if ok, _ := path.Match(pat, key); ok && !seen[key] && !matchAny(cs.exclude, key) {
+				seen[key] = true
+				out = append(out, key)
+			}
+		}
+	}
+	return out
+}
+
+// prune deletes the keys not selected from the nested map m recursively,
+// and the maps left empty.  Keys are matched by their flatten names,
+// which are the dotted paths unless renamed in names by mapconv.FlattenNames.
+func (cs *columnSelector) prune(m map[string]interface{}, prefix string, names map[string]string) {
+	for key, val := range m {
+		if sub, ok := val.(map[string]interface{}); ok {
+			cs.prune(sub, prefix+key+".", names)
+			if len(sub) == 0 {
+				delete(m, key)
+			}
+			continue
+		}
+		name, ok := names[prefix+key]
+		if !ok {
+			name = prefix + key
+		}
+		if !cs.match(name) {
+			delete(m, key)
+		}
+	}
+}
+
+// marshalOrdered encodes the flat map m as a JSON object with keys in the order.
+func marshalOrdered(m map[string]interface{}, keys []string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	n := 0
+	for _, key := range keys {
+		val, ok := m[key]
+		if !ok {
+			continue
+		}
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		n++
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
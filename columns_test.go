@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/consumption/mgmt/2019-10-01/consumption"
+	"github.com/Azure/go-autorest/autorest/date"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/shopspring/decimal"
+	"github.com/yaegashi/azbill/mapconv"
+)
+
+func TestColumnSelectorOrder(t *testing.T) {
+	keys := []string{
+		"id",
+		"properties.cost",
+		"properties.date",
+		"properties.meterDetails.meterCategory",
+		"properties.meterDetails.meterName",
+		"properties.resourceGroup",
+		"tags",
+	}
+	tests := []struct {
+		i, e string
+		x    string
+		ok   bool
+	}{
+		{i: "", e: "", x: "", ok: true},
+		{i: "properties.date,properties.cost,properties.resourceGroup", x: "properties.date,properties.cost,properties.resourceGroup", ok: true},
+		{i: "properties.date,properties.meterDetails.*,id", x: "properties.date,properties.meterDetails.meterCategory,properties.meterDetails.meterName,id", ok: true},
+		{i: "properties.*", e: "properties.meterDetails.*", x: "properties.cost,properties.date,properties.resourceGroup", ok: true},
+		{e: "properties.*", x: "id,tags", ok: true},
+		{i: "properties.cost,missing,properties.cost", x: "properties.cost,missing", ok: true},
+		{i: "properties.[", ok: false},
+		{i: "id,,tags", ok: false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			cs, err := parseColumns(tt.i, tt.e)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("Error expected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cs == nil {
+				if tt.x != "" {
+					t.Errorf("Selector expected")
+				}
+				return
+			}
+			if x := strings.Join(cs.order(keys), ","); x != tt.x {
+				t.Errorf("Columns mismatch\nwant: %s\n got: %s", tt.x, x)
+			}
+		})
+	}
+}
+
+func TestColumnSelectorPrune(t *testing.T) {
+	tests := []struct {
+		i, e  string
+		names map[string]string
+		j     string
+	}{
+		{i: "properties.cost,tags", j: `{"properties":{"cost":"1"},"tags":{"env":"prod"}}`},
+		{i: "cost,tags", names: map[string]string{"properties.cost": "cost"}, j: `{"properties":{"cost":"1"},"tags":{"env":"prod"}}`},
+		{i: "properties.cost", names: map[string]string{"properties.cost": "cost"}, j: `{}`},
+		{e: "cost", names: map[string]string{"properties.cost": "cost"}, j: `{"id":"x","properties":{"meterDetails":{"meterName":"n"}},"tags":{"env":"prod"}}`},
+		{e: "properties.meterDetails.*", j: `{"id":"x","properties":{"cost":"1"},"tags":{"env":"prod"}}`},
+		{i: "properties.meterDetails.meterName", j: `{"properties":{"meterDetails":{"meterName":"n"}}}`},
+		{i: "none", j: `{}`},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			m := map[string]interface{}{
+				"id": "x",
+				"properties": map[string]interface{}{
+					"cost":         "1",
+					"meterDetails": map[string]interface{}{"meterName": "n"},
+				},
+				"tags": map[string]string{"env": "prod"},
+			}
+			cs, err := parseColumns(tt.i, tt.e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cs.prune(m, "", tt.names)
+			b, err := json.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.j {
+				t.Errorf("JSON mismatch\nwant: %s\n got: %s", tt.j, b)
+			}
+		})
+	}
+}
+
+func TestMarshalOrdered(t *testing.T) {
+	m := map[string]interface{}{"b": 1, "a": "x", "c": []int{1}}
+	b, err := marshalOrdered(m, []string{"c", "missing", "b", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := `{"c":[1],"b":1,"a":"x"}`; string(b) != x {
+		t.Errorf("JSON mismatch want %s got %s", x, b)
+	}
+}
+
+func TestJSONMarshalColumns(t *testing.T) {
+	type LegacyUsageDetail consumption.LegacyUsageDetail
+	cost := decimal.RequireFromString("1.5")
+	v := &LegacyUsageDetail{
+		ID: to.StringPtr("u1"),
+		LegacyUsageDetailProperties: &consumption.LegacyUsageDetailProperties{
+			Date:          &date.Time{Time: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)},
+			Cost:          &cost,
+			ResourceGroup: to.StringPtr("rg"),
+		},
+	}
+	tests := []struct {
+		i, e string
+		j    string
+	}{
+		{i: "date,cost,properties.resourceGroup", j: `{"properties":{"cost":"1.5","date":"2020-06-01T00:00:00Z","resourceGroup":"rg"}}`},
+		{e: "properties.*", j: `{"id":"u1","kind":"","properties":{"cost":"1.5","date":"2020-06-01T00:00:00Z"},"tags":null}`},
+		{e: "date,cost", j: `{"id":"u1","kind":"","properties":{"resourceGroup":"rg"},"tags":null}`},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			cs, err := parseColumns(tt.i, tt.e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			app := &App{Writer: nopWriteCloser{&buf}, Convert: mapconv.Nested, Columns: cs, IsStdout: true}
+			err = app.JSONMarshal(context.Background(), v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(buf.String()); got != tt.j {
+				t.Errorf("JSON mismatch\nwant: %s\n got: %s", tt.j, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+// Package expr evaluates boolean expressions on flattened records.
+//
+// An expression compares fields of a record by their flattened keys with literals:
+//
+//	cost > 0 && properties.resourceGroup =~ "^prod-" && date >= "2020-06-01"
+//
+// Comparisons are numeric if both sides are numbers, chronological if both are dates,
+// and lexical otherwise.  =~ and !~ match a regular expression literal.
+// Conditions are combined by &&, || and !, and grouped by parentheses.
+// A missing field is an empty string.
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Expr is a parsed expression.
+type Expr struct {
+	root node
+}
+
+// Parse parses the expression s.
+func Parse(s string) (*Expr, error) {
+	p := &parser{s: s}
+	p.next()
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Expr{root: n}, nil
+}
+
+// Match reports whether the flattened record m satisfies the expression.
+func (e *Expr) Match(m map[string]interface{}) bool {
+	return truth(e.root.eval(m))
+}
+
+type node interface {
+	eval(m map[string]interface{}) interface{}
+}
+
+type literal struct{ v interface{} }
+
+func (n literal) eval(map[string]interface{}) interface{} { return n.v }
+
+type field struct{ key string }
+
+func (n field) eval(m map[string]interface{}) interface{} {
+	switch v := m[n.key].(type) {
+	case nil:
+		return ""
+	case string, bool:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type not struct{ x node }
+
+func (n not) eval(m map[string]interface{}) interface{} { return !truth(n.x.eval(m)) }
+
+type logical struct {
+	and  bool
+	x, y node
+}
+
+func (n logical) eval(m map[string]interface{}) interface{} {
+	if truth(n.x.eval(m)) != n.and {
+		return !n.and
+	}
+	return truth(n.y.eval(m))
+}
+
+type compare struct {
+	op   string
+	x, y node
+}
+
+func (n compare) eval(m map[string]interface{}) interface{} {
+	c := cmp(str(n.x.eval(m)), str(n.y.eval(m)))
+	switch n.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+type match struct {
+	neg bool
+	x   node
+	re  *regexp.Regexp
+}
+
+func (n match) eval(m map[string]interface{}) interface{} {
+	return n.re.MatchString(str(n.x.eval(m))) != n.neg
+}
+
+func truth(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	}
+	return false
+}
+
+func str(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// dateLayouts are the layouts of dates compared chronologically.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02",
+}
+
+func parseTime(s string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// cmp compares a and b as numbers, dates or strings in this order of preference.
+func cmp(a, b string) int {
+	if x, err := decimal.NewFromString(a); err == nil {
+		if y, err := decimal.NewFromString(b); err == nil {
+			return x.Cmp(y)
+		}
+	}
+	if x, ok := parseTime(a); ok {
+		if y, ok := parseTime(b); ok {
+			switch {
+			case x.Before(y):
+				return -1
+			case x.After(y):
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	val  string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.val)
+	}
+	return fmt.Sprintf("%q", t.val)
+}
+
+type parser struct {
+	s   string
+	pos int
+	tok token
+	err error
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at %d: %s", p.tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"}
+
+func isIdent(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !first && (c >= '0' && c <= '9' || c == '.' || c == '-')
+}
+
+// next scans the next token.  A scanning error is kept in p.err and reported by the caller.
+func (p *parser) next() {
+	for p.pos < len(p.s) && strings.ContainsRune(" \t\r\n", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.s) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+	c := p.s[p.pos]
+	switch {
+	case c == '"':
+		for p.pos++; p.pos < len(p.s) && p.s[p.pos] != '"'; p.pos++ {
+			if p.s[p.pos] == '\\' {
+				p.pos++
+			}
+		}
+		if p.pos >= len(p.s) {
+			p.tok = token{kind: tokOp, val: p.s[start:], pos: start}
+			p.err = fmt.Errorf("at %d: unterminated string", start+1)
+			return
+		}
+		p.pos++
+		val, err := strconv.Unquote(p.s[start:p.pos])
+		if err != nil {
+			p.err = fmt.Errorf("at %d: invalid string %s", start+1, p.s[start:p.pos])
+		}
+		p.tok = token{kind: tokString, val: val, pos: start}
+		return
+	case c == '-' || c >= '0' && c <= '9':
+		p.pos++
+		for p.pos < len(p.s) && (p.s[p.pos] >= '0' && p.s[p.pos] <= '9' || p.s[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, val: p.s[start:p.pos], pos: start}
+		return
+	case isIdent(c, true):
+		for p.pos < len(p.s) && isIdent(p.s[p.pos], false) {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, val: p.s[start:p.pos], pos: start}
+		return
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			p.pos += len(op)
+			p.tok = token{kind: tokOp, val: op, pos: start}
+			return
+		}
+	}
+	p.pos++
+	p.tok = token{kind: tokOp, val: p.s[start:p.pos], pos: start}
+	p.err = fmt.Errorf("at %d: unexpected %q", start+1, c)
+}
+
+func (p *parser) advance() error {
+	if p.err != nil {
+		return p.err
+	}
+	p.next()
+	return p.err
+}
+
+func (p *parser) or() (node, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && p.tok.val == "||" {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = logical{and: false, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) and() (node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && p.tok.val == "&&" {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = logical{and: true, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.tok.kind == tokOp && p.tok.val == "!" {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not{x: x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokOp {
+		return x, nil
+	}
+	op := p.tok.val
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		y, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		return compare{op: op, x: x, y: y}, nil
+	case "=~", "!~":
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokString {
+			return nil, p.errorf("%s requires a string literal, got %s", op, p.tok)
+		}
+		re, err := regexp.Compile(p.tok.val)
+		if err != nil {
+			return nil, p.errorf("%s", err)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return match{neg: op == "!~", x: x, re: re}, nil
+	}
+	return x, nil
+}
+
+func (p *parser) primary() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokOp:
+		if tok.val != "(" {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokOp || p.tok.val != ")" {
+			return nil, p.errorf("expected \")\", got %s", p.tok)
+		}
+		return x, p.advance()
+	case tokString:
+		return literal{v: tok.val}, p.advance()
+	case tokNumber:
+		if _, err := decimal.NewFromString(tok.val); err != nil {
+			return nil, p.errorf("invalid number %s", tok.val)
+		}
+		return literal{v: tok.val}, p.advance()
+	case tokIdent:
+		switch tok.val {
+		case "true":
+			return literal{v: true}, p.advance()
+		case "false":
+			return literal{v: false}, p.advance()
+		}
+		return field{key: tok.val}, p.advance()
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
@@ -0,0 +1,72 @@
+package expr
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	m := map[string]interface{}{
+		"cost":                             "12.50",
+		"quantity":                         "0",
+		"date":                             "2020-06-15T00:00:00Z",
+		"properties.resourceGroup":         "prod-web",
+		"properties.isAzureCreditEligible": true,
+		"properties.chargeType":            "Usage",
+	}
+	tests := []struct {
+		s string
+		b bool
+	}{
+		{s: `cost > 0`, b: true},
+		{s: `cost > 9`, b: true},
+		{s: `cost == 12.5`, b: true},
+		{s: `cost <= -1`, b: false},
+		{s: `quantity != 0`, b: false},
+		{s: `date >= "2020-06-01" && date < "2020-07-01"`, b: true},
+		{s: `date < "2020-06-15 00:00:00 +0000 UTC"`, b: false},
+		{s: `properties.resourceGroup =~ "^prod-"`, b: true},
+		{s: `properties.resourceGroup !~ "^prod-"`, b: false},
+		{s: `cost > 0 && properties.resourceGroup =~ "^dev-"`, b: false},
+		{s: `cost > 0 && properties.resourceGroup =~ "^dev-" || properties.chargeType == "Usage"`, b: true},
+		{s: `cost > 0 && (properties.resourceGroup =~ "^dev-" || properties.chargeType == "Refund")`, b: false},
+		{s: `!(cost > 100)`, b: true},
+		{s: `properties.isAzureCreditEligible`, b: true},
+		{s: `properties.isAzureCreditEligible == false`, b: false},
+		{s: `properties.missing == ""`, b: true},
+		{s: `properties.missing`, b: false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			e, err := Parse(tt.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := e.Match(m); b != tt.b {
+				t.Errorf("Match mismatch for %q want %v got %v", tt.s, tt.b, b)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []string{
+		``,
+		`cost >`,
+		`cost > 0 &&`,
+		`(cost > 0`,
+		`cost > 0)`,
+		`cost =~ date`,
+		`cost =~ "("`,
+		`cost > "0`,
+		`cost # 0`,
+		`cost > 1.2.3`,
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			if _, err := Parse(tt); err == nil {
+				t.Errorf("Error expected for %q", tt)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yaegashi/azbill/mapconv"
+)
+
+// odataQuote quotes s as an OData string literal.
+func odataQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// parseTagFilter splits --filter-tag key=value.
+func parseTagFilter(s string) (string, string, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return "", "", fmt.Errorf("invalid --filter-tag: %q", s)
+	}
+	return kv[0], kv[1], nil
+}
+
+// usageFilter is a client-side condition on a flattened usage detail.
+type usageFilter func(m map[string]interface{}) bool
+
+// matchFlat returns a usageFilter accepting the records whose first non-empty
+// value of keys equals any of vals case-insensitively.
+func matchFlat(keys []string, vals []string) usageFilter {
+	return func(m map[string]interface{}) bool {
+		s := ""
+		for _, key := range keys {
+			if v, ok := m[key].(string); ok && v != "" {
+				s = v
+				break
+			}
+		}
+		for _, val := range vals {
+			if strings.EqualFold(s, val) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// matchTag returns a usageFilter accepting the records tagged with key=val.
+// Tag keys are compared case-insensitively as Azure does.
+func matchTag(key, val string) usageFilter {
+	return func(m map[string]interface{}) bool {
+		tags, _ := m["tags"].(map[string]*string)
+		for k, v := range tags {
+			if strings.EqualFold(k, key) && v != nil && *v == val {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// buildFilter composes the $filter of the consumption API from the date range,
+// the structured filter flags and --odata-filter.  The conditions the API
+// can't express are returned as client-side filters on flattened records.
+func (app *AppUsageDetails) buildFilter() (string, []usageFilter, error) {
+	var conds []string
+	var client []usageFilter
+	if app.StartDate != "" && app.EndDate != "" {
+		conds = append(conds, fmt.Sprintf("properties/usageStart eq '%s' and properties/usageEnd eq '%s'", app.StartDate, app.EndDate))
+	}
+	// The API supports only eq combined by and, so that multiple values
+	// of a flag fall back to client-side filtering.
+	for _, f := range []struct {
+		vals     []string
+		property string
+		keys     []string
+	}{
+		{app.FilterResourceGroups, "properties/resourceGroup", []string{"properties.resourceGroup"}},
+		{app.FilterChargeTypes, "properties/chargeType", []string{"properties.chargeType"}},
+		{app.FilterMeterCategories, "", []string{"properties.meterDetails.meterCategory", "properties.meterCategory"}},
+	} {
+		switch {
+		case len(f.vals) == 0:
+		case len(f.vals) == 1 && f.property != "":
+			conds = append(conds, fmt.Sprintf("%s eq %s", f.property, odataQuote(f.vals[0])))
+		default:
+			client = append(client, matchFlat(f.keys, f.vals))
+		}
+	}
+	// The API takes a single tag condition.
+	for i, t := range app.FilterTags {
+		key, val, err := parseTagFilter(t)
+		if err != nil {
+			return "", nil, err
+		}
+		if i == 0 {
+			conds = append(conds, fmt.Sprintf("tags eq %s", odataQuote(key+":"+val)))
+		} else {
+			client = append(client, matchTag(key, val))
+		}
+	}
+	if app.ODataFilter != "" {
+		conds = append(conds, app.ODataFilter)
+	}
+	return strings.Join(conds, " and "), client, nil
+}
+
+// matchFilters reports whether the usage detail v satisfies all of filters.
+func matchFilters(v interface{}, filters []usageFilter) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	m, err := mapconv.Flatten(v, true)
+	if err != nil {
+		return false
+	}
+	for _, f := range filters {
+		if !f(m) {
+			return false
+		}
+	}
+	return true
+}
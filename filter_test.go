@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/consumption/mgmt/2019-10-01/consumption"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestBuildFilter(t *testing.T) {
+	tests := []struct {
+		app AppUsageDetails
+		f   string
+		n   int
+		e   string
+	}{
+		{app: AppUsageDetails{}, f: ""},
+		{
+			app: AppUsageDetails{StartDate: "2020-06-01", EndDate: "2020-06-30", FilterResourceGroups: []string{"prod-web"}},
+			f:   "properties/usageStart eq '2020-06-01' and properties/usageEnd eq '2020-06-30' and properties/resourceGroup eq 'prod-web'",
+		},
+		{
+			app: AppUsageDetails{FilterChargeTypes: []string{"Usage"}, FilterTags: []string{"env=prod", "owner=o'neil"}},
+			f:   "properties/chargeType eq 'Usage' and tags eq 'env:prod'",
+			n:   1,
+		},
+		{
+			app: AppUsageDetails{FilterTags: []string{"costCenter=a=b"}, ODataFilter: "properties/publisherType eq 'azure'"},
+			f:   "tags eq 'costCenter:a=b' and properties/publisherType eq 'azure'",
+		},
+		{
+			app: AppUsageDetails{FilterResourceGroups: []string{"rg1", "rg2"}, FilterMeterCategories: []string{"Storage"}},
+			f:   "",
+			n:   2,
+		},
+		{app: AppUsageDetails{FilterResourceGroups: []string{"o'neil"}}, f: "properties/resourceGroup eq 'o''neil'"},
+		{app: AppUsageDetails{FilterTags: []string{"=prod"}}, e: "invalid --filter-tag"},
+		{app: AppUsageDetails{FilterTags: []string{"env"}}, e: "invalid --filter-tag"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			f, filters, err := tt.app.buildFilter()
+			if tt.e != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.e) {
+					t.Errorf("Error mismatch want %q got %v", tt.e, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f != tt.f {
+				t.Errorf("Filter mismatch want %q got %q", tt.f, f)
+			}
+			if len(filters) != tt.n {
+				t.Errorf("Client filter count mismatch want %d got %d", tt.n, len(filters))
+			}
+		})
+	}
+}
+
+func TestMatchFilters(t *testing.T) {
+	type LegacyUsageDetail consumption.LegacyUsageDetail
+	type ModernUsageDetail consumption.ModernUsageDetail
+	legacy := &LegacyUsageDetail{
+		Tags: map[string]*string{"Env": to.StringPtr("prod")},
+		LegacyUsageDetailProperties: &consumption.LegacyUsageDetailProperties{
+			ResourceGroup: to.StringPtr("Prod-Web"),
+			MeterDetails:  &consumption.MeterDetailsResponse{MeterCategory: to.StringPtr("Storage")},
+		},
+	}
+	modern := &ModernUsageDetail{
+		ModernUsageDetailProperties: &consumption.ModernUsageDetailProperties{
+			ResourceGroup: to.StringPtr("dev"),
+			MeterCategory: to.StringPtr("Storage"),
+		},
+	}
+	tests := []struct {
+		app    AppUsageDetails
+		legacy bool
+		modern bool
+	}{
+		{app: AppUsageDetails{}, legacy: true, modern: true},
+		{app: AppUsageDetails{FilterResourceGroups: []string{"prod-web", "other"}}, legacy: true, modern: false},
+		{app: AppUsageDetails{FilterMeterCategories: []string{"storage"}}, legacy: true, modern: true},
+		{app: AppUsageDetails{FilterMeterCategories: []string{"Compute"}}, legacy: false, modern: false},
+		{app: AppUsageDetails{FilterTags: []string{"x=y", "env=prod"}}, legacy: true, modern: false},
+		{app: AppUsageDetails{FilterTags: []string{"x=y", "env=Prod"}}, legacy: false, modern: false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			_, filters, err := tt.app.buildFilter()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := matchFilters(legacy, filters); b != tt.legacy {
+				t.Errorf("Legacy match mismatch want %v got %v", tt.legacy, b)
+			}
+			if b := matchFilters(modern, filters); b != tt.modern {
+				t.Errorf("Modern match mismatch want %v got %v", tt.modern, b)
+			}
+		})
+	}
+}
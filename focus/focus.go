@@ -0,0 +1,262 @@
+// Package focus converts usage details to FinOps Open Cost and Usage Specification (FOCUS) columns.
+package focus
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/yaegashi/azbill/schema"
+)
+
+// Columns are the FOCUS columns in order.
+var Columns = []string{
+	"BilledCost",
+	"BillingAccountId",
+	"BillingAccountName",
+	"BillingCurrency",
+	"BillingPeriodEnd",
+	"BillingPeriodStart",
+	"ChargeCategory",
+	"ChargeClass",
+	"ChargeDescription",
+	"ChargeFrequency",
+	"ChargePeriodEnd",
+	"ChargePeriodStart",
+	"CommitmentDiscountId",
+	"CommitmentDiscountName",
+	"CommitmentDiscountType",
+	"ConsumedQuantity",
+	"ConsumedUnit",
+	"ContractedUnitPrice",
+	"EffectiveCost",
+	"InvoiceIssuerName",
+	"ListCost",
+	"ListUnitPrice",
+	"PricingQuantity",
+	"PricingUnit",
+	"ProviderName",
+	"PublisherName",
+	"RegionId",
+	"RegionName",
+	"ResourceId",
+	"ResourceName",
+	"ServiceName",
+	"SkuId",
+	"SkuPriceId",
+	"SubAccountId",
+	"SubAccountName",
+	"Tags",
+}
+
+// fields maps the FOCUS columns taken as is to the flattened keys of legacy and modern usage details.
+// Date, decimal and UUID values are flattened to the top level.
+var fields = map[string][2]string{
+	"BilledCost":             {"cost", "costInBillingCurrency"},
+	"BillingAccountId":       {"properties.billingAccountId", "properties.billingAccountId"},
+	"BillingAccountName":     {"properties.billingAccountName", "properties.billingAccountName"},
+	"BillingCurrency":        {"properties.billingCurrency", "properties.billingCurrencyCode"},
+	"ChargeDescription":      {"properties.meterDetails.meterName", "properties.meterName"},
+	"CommitmentDiscountId":   {"properties.reservationId", "properties.reservationId"},
+	"CommitmentDiscountName": {"properties.reservationName", "properties.reservationName"},
+	"ContractedUnitPrice":    {"unitPrice", "unitPrice"},
+	"ListCost":               {"", "paygCostInBillingCurrency"},
+	"ListUnitPrice":          {"", "marketPrice"},
+	"PublisherName":          {"properties.publisherName", "properties.publisherName"},
+	"RegionName":             {"properties.resourceLocation", "properties.resourceLocation"},
+	"ResourceId":             {"properties.resourceId", "properties.instanceName"},
+	"ServiceName":            {"properties.meterDetails.meterCategory", "properties.meterCategory"},
+	"SkuId":                  {"properties.partNumber", "properties.productIdentifier"},
+	"SkuPriceId":             {"meterId", "meterId"},
+	"SubAccountId":           {"properties.subscriptionId", "properties.subscriptionGuid"},
+	"SubAccountName":         {"properties.subscriptionName", "properties.subscriptionName"},
+}
+
+// chargeCategories maps charge types to FOCUS charge categories.
+var chargeCategories = map[string]string{
+	"Usage":              "Usage",
+	"UnusedReservation":  "Usage",
+	"UnusedSavingsPlan":  "Usage",
+	"Purchase":           "Purchase",
+	"Refund":             "Purchase",
+	"Tax":                "Tax",
+	"RoundingAdjustment": "Adjustment",
+}
+
+// chargeFrequencies maps frequencies to FOCUS charge frequencies.
+var chargeFrequencies = map[string]string{
+	"OneTime":    "One-Time",
+	"Recurring":  "Recurring",
+	"UsageBased": "Usage-Based",
+}
+
+// Transform converts flattened legacy and modern usage details to FOCUS columns.
+// It implements schema.Transform.
+//
+// FOCUS EffectiveCost is the amortized cost, while BilledCost is the invoiced one.
+// The cost of usage details is either of them by the metric they're listed with,
+// so that the other column is left empty for the rows related to commitment discounts
+// (reservation purchases and refunds, covered usage and unused reservations),
+// where it differs.  Both are set for the other rows.
+type Transform struct {
+	// Amortized is true for usage details listed with the amortized cost metric.
+	Amortized bool
+}
+
+var _ schema.Transform = Transform{}
+
+// Keys returns Columns.
+func (Transform) Keys() []string {
+	return Columns
+}
+
+// Apply returns the FOCUS columns of the flattened usage detail m.
+func (tr Transform) Apply(m map[string]interface{}) (map[string]interface{}, error) {
+	kind := str(m, "kind")
+	var i int
+	switch kind {
+	case "legacy":
+		i = 0
+	case "modern":
+		i = 1
+	default:
+		return nil, fmt.Errorf("unsupported usage detail kind %q for FOCUS", kind)
+	}
+	out := map[string]interface{}{}
+	set := func(col, val string) {
+		if val != "" {
+			out[col] = val
+		}
+	}
+	for col, keys := range fields {
+		if keys[i] != "" {
+			set(col, str(m, keys[i]))
+		}
+	}
+	for _, col := range []string{"BilledCost", "ContractedUnitPrice", "ListCost", "ListUnitPrice"} {
+		if s, ok := out[col].(string); ok {
+			d, err := decimal.NewFromString(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid number %q", col, s)
+			}
+			out[col] = json.Number(d.String())
+		}
+	}
+	chargeType := str(m, "properties.chargeType")
+	commitment := out["CommitmentDiscountId"] != nil || strings.HasPrefix(chargeType, "Unused")
+	if cost, ok := out["BilledCost"]; ok {
+		if tr.Amortized {
+			out["EffectiveCost"] = cost
+			if commitment {
+				delete(out, "BilledCost")
+			}
+		} else if !commitment {
+			out["EffectiveCost"] = cost
+		}
+	}
+
+	set("ChargeCategory", chargeCategories[chargeType])
+	if chargeType == "Refund" {
+		out["ChargeClass"] = "Correction"
+	}
+	set("ChargeFrequency", chargeFrequencies[str(m, "properties.frequency")])
+	if out["CommitmentDiscountId"] != nil {
+		out["CommitmentDiscountType"] = "Reservation"
+	}
+
+	for col, key := range map[string]string{
+		"BillingPeriodStart": "billingPeriodStartDate",
+		"BillingPeriodEnd":   "billingPeriodEndDate",
+		"ChargePeriodStart":  "date",
+	} {
+		if s := str(m, key); s != "" {
+			t, err := schema.ParseTime(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", col, err)
+			}
+			out[col] = t.Format(time.RFC3339)
+			if col == "ChargePeriodStart" {
+				out["ChargePeriodEnd"] = t.AddDate(0, 0, 1).Format(time.RFC3339)
+			}
+		}
+	}
+
+	unit := str(m, [2]string{"properties.meterDetails.unitOfMeasure", "properties.unitOfMeasure"}[i])
+	if q := str(m, "quantity"); q != "" {
+		d, err := decimal.NewFromString(q)
+		if err != nil {
+			return nil, fmt.Errorf("quantity: invalid number %q", q)
+		}
+		out["PricingQuantity"] = json.Number(d.String())
+		set("PricingUnit", unit)
+		if out["ChargeCategory"] == "Usage" {
+			out["ConsumedQuantity"] = json.Number(d.String())
+			set("ConsumedUnit", unit)
+		}
+	}
+
+	out["InvoiceIssuerName"] = "Microsoft"
+	if s := str(m, "properties.partnerName"); s != "" {
+		out["InvoiceIssuerName"] = s
+	}
+	out["ProviderName"] = "Microsoft"
+	if out["PublisherName"] == nil && str(m, "properties.publisherType") == "Azure" {
+		out["PublisherName"] = "Microsoft"
+	}
+
+	region := str(m, "properties.resourceLocationNormalized")
+	if region == "" {
+		region = strings.ToLower(strings.ReplaceAll(str(m, "properties.resourceLocation"), " ", ""))
+	}
+	set("RegionId", region)
+
+	name := str(m, "properties.resourceName")
+	if name == "" {
+		if id := str(m, "properties.instanceName"); strings.HasPrefix(id, "/") {
+			name = id[strings.LastIndex(id, "/")+1:]
+		}
+	}
+	set("ResourceName", name)
+
+	tags, err := Tags(m["tags"])
+	if err != nil {
+		return nil, err
+	}
+	out["Tags"] = tags
+	return out, nil
+}
+
+// Tags returns the tags as a JSON object string, either from a map or a JSON string.
+func Tags(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "{}", nil
+	case string:
+		if t == "" {
+			return "{}", nil
+		}
+		return t, nil
+	case map[string]*string:
+		if t == nil {
+			return "{}", nil
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func str(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,153 @@
+package focus
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/consumption/mgmt/2019-10-01/consumption"
+	"github.com/Azure/go-autorest/autorest/date"
+	"github.com/shopspring/decimal"
+	"github.com/yaegashi/azbill/mapconv"
+)
+
+func TestTransform(t *testing.T) {
+	type legacyUsageDetail consumption.LegacyUsageDetail
+	type modernUsageDetail consumption.ModernUsageDetail
+	s := func(s string) *string { return &s }
+	d := func(s string) *decimal.Decimal { v := decimal.RequireFromString(s); return &v }
+	day := &date.Time{Time: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		v interface{}
+		a bool
+		j string
+	}{
+		{
+			v: legacyUsageDetail{
+				Kind: consumption.KindLegacy,
+				Tags: map[string]*string{"env": s("prod")},
+				LegacyUsageDetailProperties: &consumption.LegacyUsageDetailProperties{
+					BillingCurrency:  s("JPY"),
+					ChargeType:       s("Usage"),
+					Frequency:        s("UsageBased"),
+					Cost:             d("0.0551"),
+					Quantity:         d("0.000997"),
+					UnitPrice:        d("55.3"),
+					Date:             day,
+					ResourceID:       s("/subscriptions/sub/resourceGroups/dns/providers/Microsoft.Network/dnszones/l0w.dev"),
+					ResourceName:     s("l0w.dev"),
+					ResourceLocation: s("Japan East"),
+					SubscriptionID:   s("sub"),
+					PublisherType:    s("Azure"),
+					MeterDetails: &consumption.MeterDetailsResponse{
+						MeterCategory: s("Azure DNS"),
+						MeterName:     s("Public Queries"),
+						UnitOfMeasure: s("10000000"),
+					},
+				},
+			},
+			j: `{"BilledCost":0.0551,"BillingCurrency":"JPY","ChargeCategory":"Usage","ChargeDescription":"Public Queries","ChargeFrequency":"Usage-Based","ChargePeriodEnd":"2020-06-02T00:00:00Z","ChargePeriodStart":"2020-06-01T00:00:00Z","ConsumedQuantity":0.000997,"ConsumedUnit":"10000000","ContractedUnitPrice":55.3,"EffectiveCost":0.0551,"InvoiceIssuerName":"Microsoft","PricingQuantity":0.000997,"PricingUnit":"10000000","ProviderName":"Microsoft","PublisherName":"Microsoft","RegionId":"japaneast","RegionName":"Japan East","ResourceId":"/subscriptions/sub/resourceGroups/dns/providers/Microsoft.Network/dnszones/l0w.dev","ResourceName":"l0w.dev","ServiceName":"Azure DNS","SubAccountId":"sub","Tags":"{\"env\":\"prod\"}"}`,
+		},
+		{
+			v: modernUsageDetail{
+				Kind: consumption.KindModern,
+				ModernUsageDetailProperties: &consumption.ModernUsageDetailProperties{
+					BillingCurrencyCode:        s("USD"),
+					ChargeType:                 s("Refund"),
+					Frequency:                  s("OneTime"),
+					CostInBillingCurrency:      d("-10"),
+					PaygCostInBillingCurrency:  d("-12"),
+					Quantity:                   d("1"),
+					Date:                       day,
+					InstanceName:               s("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm"),
+					ResourceLocationNormalized: s("eastus"),
+					SubscriptionGUID:           s("sub"),
+					ReservationID:              s("ri"),
+					PartnerName:                s("Partner"),
+					UnitOfMeasure:              s("1 Hour"),
+				},
+			},
+			j: `{"BilledCost":-10,"BillingCurrency":"USD","ChargeCategory":"Purchase","ChargeClass":"Correction","ChargeFrequency":"One-Time","ChargePeriodEnd":"2020-06-02T00:00:00Z","ChargePeriodStart":"2020-06-01T00:00:00Z","CommitmentDiscountId":"ri","CommitmentDiscountType":"Reservation","InvoiceIssuerName":"Partner","ListCost":-12,"PricingQuantity":1,"PricingUnit":"1 Hour","ProviderName":"Microsoft","RegionId":"eastus","ResourceId":"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm","ResourceName":"vm","SubAccountId":"sub","Tags":"{}"}`,
+		},
+		{
+			v: legacyUsageDetail{
+				Kind: consumption.KindLegacy,
+				LegacyUsageDetailProperties: &consumption.LegacyUsageDetailProperties{
+					ChargeType:    s("Usage"),
+					Cost:          d("0"),
+					ReservationID: s("ri"),
+				},
+			},
+			j: `{"BilledCost":0,"ChargeCategory":"Usage","CommitmentDiscountId":"ri","CommitmentDiscountType":"Reservation","InvoiceIssuerName":"Microsoft","ProviderName":"Microsoft","Tags":"{}"}`,
+		},
+		{
+			v: legacyUsageDetail{
+				Kind: consumption.KindLegacy,
+				LegacyUsageDetailProperties: &consumption.LegacyUsageDetailProperties{
+					ChargeType:    s("Usage"),
+					Cost:          d("0.5"),
+					ReservationID: s("ri"),
+				},
+			},
+			a: true,
+			j: `{"ChargeCategory":"Usage","CommitmentDiscountId":"ri","CommitmentDiscountType":"Reservation","EffectiveCost":0.5,"InvoiceIssuerName":"Microsoft","ProviderName":"Microsoft","Tags":"{}"}`,
+		},
+		{
+			v: legacyUsageDetail{
+				Kind: consumption.KindLegacy,
+				LegacyUsageDetailProperties: &consumption.LegacyUsageDetailProperties{
+					ChargeType: s("UnusedReservation"),
+					Cost:       d("0.2"),
+				},
+			},
+			a: true,
+			j: `{"ChargeCategory":"Usage","EffectiveCost":0.2,"InvoiceIssuerName":"Microsoft","ProviderName":"Microsoft","Tags":"{}"}`,
+		},
+		{
+			v: legacyUsageDetail{
+				Kind: consumption.KindLegacy,
+				LegacyUsageDetailProperties: &consumption.LegacyUsageDetailProperties{
+					ChargeType: s("Usage"),
+					Cost:       d("1"),
+				},
+			},
+			a: true,
+			j: `{"BilledCost":1,"ChargeCategory":"Usage","EffectiveCost":1,"InvoiceIssuerName":"Microsoft","ProviderName":"Microsoft","Tags":"{}"}`,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			m, err := mapconv.Flatten(tt.v, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := (Transform{Amortized: tt.a}).Apply(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key := range out {
+				found := false
+				for _, col := range Columns {
+					found = found || col == key
+				}
+				if !found {
+					t.Errorf("Column %s not in Keys", key)
+				}
+			}
+			b, err := json.Marshal(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.j {
+				t.Errorf("Mismatch\nwant: %s\n got: %s", tt.j, b)
+			}
+		})
+	}
+}
+
+func TestTransformUnsupported(t *testing.T) {
+	if _, err := (Transform{}).Apply(map[string]interface{}{"kind": "other"}); err == nil {
+		t.Errorf("Error expected")
+	}
+}
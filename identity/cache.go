@@ -0,0 +1,84 @@
+package identity
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// TokenCache holds service principal tokens keyed by TokenCacheKey.
+type TokenCache struct {
+	Tokens map[string]*adal.ServicePrincipalToken `json:"tokens"`
+}
+
+// TokenCacheKey returns the cache key for a token of client in tenant on cloud.
+func TokenCacheKey(cloud, client, tenant string) string {
+	return strings.ToLower(cloud + "/" + client + "/" + tenant)
+}
+
+// NewTokenCache returns an empty TokenCache.
+func NewTokenCache() *TokenCache {
+	return &TokenCache{Tokens: map[string]*adal.ServicePrincipalToken{}}
+}
+
+// ParseTokenCache decodes a TokenCache.  A single token saved by older versions
+// is accepted and stored under the key of its client and tenant on cloud.
+func ParseTokenCache(b []byte, cloud string) (*TokenCache, error) {
+	var m map[string]json.RawMessage
+	err := json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+	c := NewTokenCache()
+	if _, ok := m["token"]; ok {
+		var legacy struct {
+			ClientID string `json:"clientID"`
+			OAuth    struct {
+				AuthorityEndpoint struct {
+					Path string
+				} `json:"authorityEndpoint"`
+			} `json:"oauth"`
+		}
+		err = json.Unmarshal(b, &legacy)
+		if err != nil {
+			return nil, err
+		}
+		var token *adal.ServicePrincipalToken
+		err = json.Unmarshal(b, &token)
+		if err != nil {
+			return nil, err
+		}
+		tenant := strings.Trim(legacy.OAuth.AuthorityEndpoint.Path, "/")
+		c.Tokens[TokenCacheKey(cloud, legacy.ClientID, tenant)] = token
+		return c, nil
+	}
+	err = json.Unmarshal(b, c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Tokens == nil {
+		c.Tokens = map[string]*adal.ServicePrincipalToken{}
+	}
+	return c, nil
+}
+
+// RefreshToken returns a refresh token of client on cloud issued for any tenant.
+// Azure AD accepts it for other tenants the user belongs to.
+func (c *TokenCache) RefreshToken(cloud, client string) string {
+	prefix := TokenCacheKey(cloud, client, "")
+	keys := []string{}
+	for key := range c.Tokens {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if rt := c.Tokens[key].Token().RefreshToken; rt != "" {
+			return rt
+		}
+	}
+	return ""
+}
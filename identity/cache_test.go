@@ -0,0 +1,75 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func newTestToken(t *testing.T, tenant, refresh string) *adal.ServicePrincipalToken {
+	oauthConfig, err := adal.NewOAuthConfig("https://login.microsoftonline.com/", tenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, "client", "https://management.azure.com/", adal.Token{AccessToken: "access-" + tenant, RefreshToken: refresh})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestTokenCache(t *testing.T) {
+	c := NewTokenCache()
+	c.Tokens[TokenCacheKey("public", "client", "common")] = newTestToken(t, "common", "rt-common")
+	c.Tokens[TokenCacheKey("public", "client", "contoso")] = newTestToken(t, "contoso", "")
+	c.Tokens[TokenCacheKey("china", "client", "common")] = newTestToken(t, "common", "rt-china")
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = ParseTokenCache(b, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Tokens) != 3 {
+		t.Errorf("Token count mismatch want 3 got %d", len(c.Tokens))
+	}
+	if token := c.Tokens["public/client/contoso"]; token == nil || token.OAuthToken() != "access-contoso" {
+		t.Errorf("Token mismatch for public/client/contoso")
+	}
+	tests := []struct {
+		cloud, client string
+		rt            string
+	}{
+		{cloud: "public", client: "client", rt: "rt-common"},
+		{cloud: "China", client: "CLIENT", rt: "rt-china"},
+		{cloud: "usgov", client: "client", rt: ""},
+		{cloud: "public", client: "other", rt: ""},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			if rt := c.RefreshToken(tt.cloud, tt.client); rt != tt.rt {
+				t.Errorf("Refresh token mismatch want %q got %q", tt.rt, rt)
+			}
+		})
+	}
+}
+
+func TestParseTokenCacheLegacy(t *testing.T) {
+	b, err := json.Marshal(newTestToken(t, "Common", "rt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ParseTokenCache(b, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token := c.Tokens["public/client/common"]; token == nil || token.OAuthToken() != "access-Common" {
+		t.Errorf("Legacy token not migrated: %v", c.Tokens)
+	}
+	if _, err := ParseTokenCache([]byte("[]"), "public"); err == nil {
+		t.Errorf("Error expected")
+	}
+}
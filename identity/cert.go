@@ -0,0 +1,62 @@
+package identity
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// DecodeCertificate extracts the certificate and RSA private key from PEM or PFX data.
+// PEM data should contain both a CERTIFICATE block and a PKCS#1 or PKCS#8 private key block.
+// The password is used only for PFX data.
+func DecodeCertificate(data []byte, password string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		return adal.DecodePfxCertificateData(data, password)
+	}
+	var certs []*x509.Certificate
+	var key *rsa.PrivateKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			certs = append(certs, cert)
+		case "RSA PRIVATE KEY":
+			k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			key = k
+		case "PRIVATE KEY":
+			k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			rk, ok := k.(*rsa.PrivateKey)
+			if !ok {
+				return nil, nil, fmt.Errorf("unsupported private key type %T", k)
+			}
+			key = rk
+		}
+	}
+	if key == nil {
+		return nil, nil, fmt.Errorf("no private key found in PEM data")
+	}
+	for _, cert := range certs {
+		if pub, ok := cert.PublicKey.(*rsa.PublicKey); ok && pub.E == key.E && pub.N.Cmp(key.N) == 0 {
+			return cert, key, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no certificate matching the private key found in PEM data")
+}
@@ -0,0 +1,57 @@
+package identity
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claims holds the access token claims of interest issued by Azure AD.
+type Claims struct {
+	TenantID   string   `json:"tid"`
+	ObjectID   string   `json:"oid"`
+	UPN        string   `json:"upn"`
+	UniqueName string   `json:"unique_name"`
+	AppID      string   `json:"appid"`
+	Scope      string   `json:"scp"`
+	Roles      []string `json:"roles"`
+	Audience   string   `json:"aud"`
+	Issuer     string   `json:"iss"`
+	ExpiresAt  int64    `json:"exp"`
+}
+
+// ParseClaims decodes the payload of a JWT access token without verifying its signature.
+func ParseClaims(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed JWT")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+	var claims Claims
+	err = json.Unmarshal(b, &claims)
+	if err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// Name returns the user principal name, or the application ID for service principals.
+func (c *Claims) Name() string {
+	if c.UPN != "" {
+		return c.UPN
+	}
+	if c.UniqueName != "" {
+		return c.UniqueName
+	}
+	return c.AppID
+}
+
+// Expires returns the expiry time of the token.
+func (c *Claims) Expires() time.Time {
+	return time.Unix(c.ExpiresAt, 0).UTC()
+}
@@ -0,0 +1,47 @@
+package identity
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+)
+
+func TestParseClaims(t *testing.T) {
+	jwt := func(payload string) string {
+		return "e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+	}
+	tests := []struct {
+		t    string
+		n, e string
+		ok   bool
+	}{
+		{t: jwt(`{"tid":"tenant","upn":"user@example.com","unique_name":"live.com#user","exp":1593993600}`), n: "user@example.com", e: "2020-07-06 00:00:00 +0000 UTC", ok: true},
+		{t: jwt(`{"tid":"tenant","unique_name":"live.com#user","exp":1593993600}`), n: "live.com#user", e: "2020-07-06 00:00:00 +0000 UTC", ok: true},
+		{t: jwt(`{"tid":"tenant","appid":"app","roles":["a"],"exp":0}`), n: "app", e: "1970-01-01 00:00:00 +0000 UTC", ok: true},
+		{t: "token", ok: false},
+		{t: "e30.!!!.sig", ok: false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			c, err := ParseClaims(tt.t)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("Error expected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.TenantID != "tenant" {
+				t.Errorf("Tenant mismatch want %q got %q", "tenant", c.TenantID)
+			}
+			if c.Name() != tt.n {
+				t.Errorf("Name mismatch want %q got %q", tt.n, c.Name())
+			}
+			if c.Expires().String() != tt.e {
+				t.Errorf("Expires mismatch want %q got %q", tt.e, c.Expires())
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package identity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+const (
+	EnvironFederatedTokenFile = "AZURE_FEDERATED_TOKEN_FILE"
+	ClientAssertionType       = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// FederatedSecret implements adal.ServicePrincipalSecret with a federated token
+// (e.g. from GitHub Actions or AKS workload identity) used as the client assertion.
+// TokenFile is re-read on every refresh since it is rotated by the platform,
+// otherwise Token is used as is.
+type FederatedSecret struct {
+	TokenFile string
+	Token     string
+}
+
+// Assertion returns the current federated token.
+func (s *FederatedSecret) Assertion() (string, error) {
+	token := s.Token
+	if s.TokenFile != "" {
+		b, err := ioutil.ReadFile(s.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		token = string(b)
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("empty federated token")
+	}
+	return token, nil
+}
+
+// SetAuthenticationValues implements adal.ServicePrincipalSecret.
+func (s *FederatedSecret) SetAuthenticationValues(spt *adal.ServicePrincipalToken, v *url.Values) error {
+	token, err := s.Assertion()
+	if err != nil {
+		return err
+	}
+	v.Set("client_assertion_type", ClientAssertionType)
+	v.Set("client_assertion", token)
+	return nil
+}
+
+// MarshalJSON implements adal.ServicePrincipalSecret.
+func (s FederatedSecret) MarshalJSON() ([]byte, error) {
+	return nil, fmt.Errorf("marshalling FederatedSecret is not supported")
+}
@@ -0,0 +1,83 @@
+package identity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestFederatedSecret(t *testing.T) {
+	file := filepath.Join(tempDir(t), "token")
+	err := ioutil.WriteFile(file, []byte("file-token\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		f, t string
+		a    string
+	}{
+		{t: "env-token", a: "env-token"},
+		{f: file, t: "env-token", a: "file-token"},
+		{a: ""},
+		{f: filepath.Join(tempDir(t), "missing"), a: ""},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				want := map[string]string{
+					"grant_type":            "client_credentials",
+					"client_id":             "client",
+					"resource":              "https://management.azure.com/",
+					"client_assertion_type": ClientAssertionType,
+					"client_assertion":      tt.a,
+				}
+				for k, v := range want {
+					if r.PostForm.Get(k) != v {
+						t.Errorf("Form %s mismatch want %q got %q", k, v, r.PostForm.Get(k))
+					}
+				}
+				fmt.Fprint(w, `{"access_token":"token","expires_in":"3600","expires_on":"4102444800","token_type":"Bearer"}`)
+			}))
+			defer ts.Close()
+			oauthConfig, err := adal.NewOAuthConfig(ts.URL, "tenant")
+			if err != nil {
+				t.Fatal(err)
+			}
+			secret := &FederatedSecret{TokenFile: tt.f, Token: tt.t}
+			token, err := adal.NewServicePrincipalTokenWithSecret(*oauthConfig, "client", "https://management.azure.com/", secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = token.EnsureFresh()
+			if tt.a == "" {
+				if err == nil {
+					t.Errorf("Error expected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.OAuthToken() != "token" {
+				t.Errorf("Token mismatch want %q got %q", "token", token.OAuthToken())
+			}
+		})
+	}
+}
+
+// tempDir returns a temporary directory removed at the end of the test.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "azbill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
@@ -0,0 +1,117 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+const (
+	DefaultIMDSEndpoint      = "http://169.254.169.254/metadata/identity/oauth2/token"
+	IMDSAPIVersion           = "2018-02-01"
+	AppServiceAPIVersion     = "2019-08-01"
+	EnvironIdentityEndpoint  = "IDENTITY_ENDPOINT"
+	EnvironIdentityHeader    = "IDENTITY_HEADER"
+	systemAssignedIdentityID = "system-assigned"
+)
+
+// ManagedIdentity describes where to request managed identity tokens.
+// When Header is set the endpoint is treated as the App Service / Container Apps
+// identity endpoint, otherwise as the Azure Instance Metadata Service (IMDS).
+type ManagedIdentity struct {
+	Endpoint string
+	Header   string
+	ClientID string
+	Client   *http.Client
+}
+
+// NewManagedIdentity returns a ManagedIdentity for the current environment.
+// IDENTITY_ENDPOINT and IDENTITY_HEADER take precedence when both are set,
+// otherwise imdsEndpoint (or DefaultIMDSEndpoint if empty) is used.
+func NewManagedIdentity(imdsEndpoint, clientID string) *ManagedIdentity {
+	mi := &ManagedIdentity{ClientID: clientID, Client: http.DefaultClient}
+	endpoint, header := os.Getenv(EnvironIdentityEndpoint), os.Getenv(EnvironIdentityHeader)
+	if imdsEndpoint == "" && endpoint != "" && header != "" {
+		mi.Endpoint = endpoint
+		mi.Header = header
+		return mi
+	}
+	if imdsEndpoint == "" {
+		imdsEndpoint = DefaultIMDSEndpoint
+	}
+	mi.Endpoint = imdsEndpoint
+	return mi
+}
+
+// ServicePrincipalToken returns a token for resource which refreshes itself from the identity endpoint.
+func (mi *ManagedIdentity) ServicePrincipalToken(resource string) (*adal.ServicePrincipalToken, error) {
+	u, err := url.Parse(mi.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	id := mi.ClientID
+	if id == "" {
+		// adal requires a non-empty id, which is not sent with a custom refresh func.
+		id = systemAssignedIdentityID
+	}
+	token, err := adal.NewServicePrincipalTokenWithSecret(adal.OAuthConfig{TokenEndpoint: *u}, id, resource, &adal.ServicePrincipalNoSecret{})
+	if err != nil {
+		return nil, err
+	}
+	token.SetCustomRefreshFunc(mi.Refresh)
+	return token, nil
+}
+
+// Refresh requests a new token for resource from the identity endpoint.
+func (mi *ManagedIdentity) Refresh(ctx context.Context, resource string) (*adal.Token, error) {
+	u, err := url.Parse(mi.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("resource", resource)
+	if mi.Header != "" {
+		q.Set("api-version", AppServiceAPIVersion)
+	} else {
+		q.Set("api-version", IMDSAPIVersion)
+	}
+	if mi.ClientID != "" {
+		q.Set("client_id", mi.ClientID)
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if mi.Header != "" {
+		req.Header.Set("X-IDENTITY-HEADER", mi.Header)
+	} else {
+		req.Header.Set("Metadata", "true")
+	}
+	cli := mi.Client
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	res, err := cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("managed identity token request failed: %s", res.Status)
+	}
+	var token adal.Token
+	err = json.NewDecoder(res.Body).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("managed identity token response has no access_token")
+	}
+	return &token, nil
+}
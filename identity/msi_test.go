@@ -0,0 +1,107 @@
+package identity
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestManagedIdentity(t *testing.T) {
+	tests := []struct {
+		h, c string
+		q    string
+	}{
+		{h: "", c: "", q: "api-version=2018-02-01&resource=https%3A%2F%2Fmanagement.azure.com%2F"},
+		{h: "", c: "client", q: "api-version=2018-02-01&client_id=client&resource=https%3A%2F%2Fmanagement.azure.com%2F"},
+		{h: "secret", c: "", q: "api-version=2019-08-01&resource=https%3A%2F%2Fmanagement.azure.com%2F"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.RawQuery != tt.q {
+					t.Errorf("Query mismatch want %q got %q", tt.q, r.URL.RawQuery)
+				}
+				if tt.h == "" && r.Header.Get("Metadata") != "true" {
+					t.Errorf("Missing Metadata header")
+				}
+				if tt.h != "" && r.Header.Get("X-IDENTITY-HEADER") != tt.h {
+					t.Errorf("Identity header mismatch want %q got %q", tt.h, r.Header.Get("X-IDENTITY-HEADER"))
+				}
+				fmt.Fprint(w, `{"access_token":"token","expires_on":"4102444800","resource":"https://management.azure.com/","token_type":"Bearer"}`)
+			}))
+			defer ts.Close()
+			mi := &ManagedIdentity{Endpoint: ts.URL, Header: tt.h, ClientID: tt.c}
+			token, err := mi.ServicePrincipalToken("https://management.azure.com/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = token.EnsureFresh()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.OAuthToken() != "token" {
+				t.Errorf("Token mismatch want %q got %q", "token", token.OAuthToken())
+			}
+		})
+	}
+}
+
+func TestManagedIdentityError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "identity not found", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+	mi := &ManagedIdentity{Endpoint: ts.URL}
+	token, err := mi.ServicePrincipalToken("https://management.azure.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = token.EnsureFresh(); err == nil {
+		t.Errorf("Error expected")
+	}
+}
+
+func TestNewManagedIdentity(t *testing.T) {
+	tests := []struct {
+		ee, eh, i string
+		e, h      string
+	}{
+		{e: DefaultIMDSEndpoint},
+		{i: "http://localhost:8080/token", e: "http://localhost:8080/token"},
+		{ee: "http://localhost:8081/msi", eh: "secret", e: "http://localhost:8081/msi", h: "secret"},
+		{ee: "http://localhost:8081/msi", eh: "secret", i: "http://localhost:8080/token", e: "http://localhost:8080/token"},
+		{ee: "http://localhost:8081/msi", e: DefaultIMDSEndpoint},
+		{eh: "secret", e: DefaultIMDSEndpoint},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			setenv(t, EnvironIdentityEndpoint, tt.ee)
+			setenv(t, EnvironIdentityHeader, tt.eh)
+			mi := NewManagedIdentity(tt.i, "client")
+			if tt.e != mi.Endpoint {
+				t.Errorf("Endpoint mismatch want %q got %q", tt.e, mi.Endpoint)
+			}
+			if tt.h != mi.Header {
+				t.Errorf("Header mismatch want %q got %q", tt.h, mi.Header)
+			}
+			if mi.ClientID != "client" {
+				t.Errorf("ClientID mismatch want %q got %q", "client", mi.ClientID)
+			}
+		})
+	}
+}
+
+// setenv sets the environment variable key to val until the end of the test.
+func setenv(t *testing.T, key, val string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, val)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
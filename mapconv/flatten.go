@@ -66,3 +66,46 @@ func Flatten(x interface{}, omit bool) (map[string]interface{}, error) {
 	}
 	return m, nil
 }
+
+// FlattenNames returns the flatten names of the fields of x which differ from
+// their dotted paths in Nested, that is, time, decimal and UUID fields in nested structs.
+func FlattenNames(x interface{}) map[string]string {
+	m := map[string]string{}
+	flattenNamesRec(reflect.TypeOf(x), "", m, map[reflect.Type]bool{})
+	return m
+}
+
+func flattenNamesRec(t reflect.Type, prefix string, m map[string]string, seen map[reflect.Type]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+	defer delete(seen, t)
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		name := ft.Name
+		if !unicode.IsUpper(rune(name[0])) {
+			continue
+		}
+		if tag, ok := ft.Tag.Lookup("json"); ok {
+			name = strings.Split(tag, ",")[0]
+			if name == "-" {
+				continue
+			}
+		}
+		fvt := ft.Type
+		for fvt.Kind() == reflect.Ptr {
+			fvt = fvt.Elem()
+		}
+		if fvt == TimeType || fvt == DecimalType || fvt == UUIDType {
+			if prefix != "" {
+				m[prefix+name] = name
+			}
+		} else if fvt.Kind() == reflect.Struct {
+			flattenNamesRec(fvt, prefix+name+".", m, seen)
+		}
+	}
+}
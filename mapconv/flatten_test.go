@@ -94,3 +94,32 @@ func TestFlatten(t *testing.T) {
 		})
 	}
 }
+
+func TestFlattenNames(t *testing.T) {
+	type legacyUsageDetail consumption.LegacyUsageDetail
+	m := FlattenNames(&legacyUsageDetail{})
+	want := map[string]string{
+		"properties.billingPeriodEndDate":   "billingPeriodEndDate",
+		"properties.billingPeriodStartDate": "billingPeriodStartDate",
+		"properties.cost":                   "cost",
+		"properties.date":                   "date",
+		"properties.effectivePrice":         "effectivePrice",
+		"properties.meterId":                "meterId",
+		"properties.quantity":               "quantity",
+		"properties.unitPrice":              "unitPrice",
+	}
+	b, _ := json.Marshal(m)
+	w, _ := json.Marshal(want)
+	if string(b) != string(w) {
+		t.Errorf("Mismatch\nwant: %s\n got: %s", w, b)
+	}
+	flat, err := Flatten(&legacyUsageDetail{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, name := range m {
+		if _, ok := flat[name]; !ok {
+			t.Errorf("Flatten name %q for %q missing in Flatten", name, path)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// atomicFile writes to a temporary file in the directory of path,
+// and renames it to path on Close so that readers never see a partial output.
+// A suspended atomicFile is closed temporarily and can be resumed to append to it.
+type atomicFile struct {
+	*os.File
+	path        string
+	keepPartial bool
+	suspended   bool
+}
+
+// createOutputFile returns the writer to the output file at path.  Existing non-regular
+// files like /dev/stdout and /dev/null are written directly, other files atomically.
+func createOutputFile(path string, keepPartial bool) (io.WriteCloser, error) {
+	if fi, err := os.Stat(path); err == nil && !fi.Mode().IsRegular() {
+		return os.OpenFile(path, os.O_WRONLY, 0)
+	}
+	return createAtomicFile(path, keepPartial)
+}
+
+// createAtomicFile returns an atomicFile for path, with the mode of the existing file or 0644.
+func createAtomicFile(path string, keepPartial bool) (*atomicFile, error) {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	err = f.Chmod(mode)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &atomicFile{File: f, path: path, keepPartial: keepPartial}, nil
+}
+
+// Suspend closes the temporary file until Resume.
+func (af *atomicFile) Suspend() error {
+	af.suspended = true
+	return af.File.Close()
+}
+
+// Resume reopens the temporary file to append to it.
+func (af *atomicFile) Resume() error {
+	f, err := os.OpenFile(af.Name(), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	af.File = f
+	af.suspended = false
+	return nil
+}
+
+// Close closes the temporary file and renames it to the path.
+func (af *atomicFile) Close() error {
+	if !af.suspended {
+		err := af.File.Close()
+		if err != nil {
+			os.Remove(af.Name())
+			return err
+		}
+	}
+	return os.Rename(af.Name(), af.path)
+}
+
+// Abort closes and removes the temporary file,
+// or renames it to the path with .partial suffix if keepPartial.
+func (af *atomicFile) Abort() error {
+	if !af.suspended {
+		af.File.Close()
+	}
+	if af.keepPartial {
+		return os.Rename(af.Name(), af.path+".partial")
+	}
+	return os.Remove(af.Name())
+}
+
+// aborter is implemented by writers which can discard the output instead of finishing it.
+type aborter interface {
+	Abort() error
+}
+
+// nopWriteCloser is a writer which is not closed by Close, such as the standard output.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// compressions maps output file extensions to compression methods.
+var compressions = map[string]string{
+	".gz":   "gzip",
+	".gzip": "gzip",
+	".zst":  "zstd",
+	".zstd": "zstd",
+}
+
+// compressionFor returns the compression method for output by its extension,
+// ignoring the query part of URLs.
+func compressionFor(output string) string {
+	if i := strings.IndexByte(output, '?'); i >= 0 && strings.Contains(output, "://") {
+		output = output[:i]
+	}
+	if c, ok := compressions[strings.ToLower(path.Ext(output))]; ok {
+		return c
+	}
+	return "none"
+}
+
+// checkCompression returns an error if compress is not a compression method of --compress.
+func checkCompression(compress string) error {
+	switch compress {
+	case "", "none", "gzip", "zstd":
+		return nil
+	}
+	return fmt.Errorf("unknown compression: %s", compress)
+}
+
+// compressWriter compresses data written to w.
+// Close finalizes the compressed stream before closing w.
+type compressWriter struct {
+	io.WriteCloser
+	w io.WriteCloser
+}
+
+func newCompressWriter(w io.WriteCloser, compress string) (io.WriteCloser, error) {
+	var zw io.WriteCloser
+	switch compress {
+	case "none":
+		return w, nil
+	case "gzip":
+		zw = gzip.NewWriter(w)
+	case "zstd":
+		var err error
+		zw, err = zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown compression: %s", compress)
+	}
+	return &compressWriter{WriteCloser: zw, w: w}, nil
+}
+
+func (cw *compressWriter) Close() error {
+	err := cw.WriteCloser.Close()
+	if err != nil {
+		if a, ok := cw.w.(aborter); ok {
+			a.Abort()
+		} else {
+			cw.w.Close()
+		}
+		return err
+	}
+	return cw.w.Close()
+}
+
+func (cw *compressWriter) Abort() error {
+	cw.WriteCloser.Close()
+	if a, ok := cw.w.(aborter); ok {
+		return a.Abort()
+	}
+	return cw.w.Close()
+}
+
+// checksumFile counts and hashes the data written to an atomicFile.
+type checksumFile struct {
+	*atomicFile
+	sum  hash.Hash
+	size int64
+}
+
+func (cf *checksumFile) Write(p []byte) (int, error) {
+	n, err := cf.atomicFile.Write(p)
+	cf.sum.Write(p[:n])
+	cf.size += int64(n)
+	return n, err
+}
+
+// countWriter counts the data written.
+type countWriter struct {
+	io.WriteCloser
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.WriteCloser.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// sizeUnits are the units accepted by parseSize.
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+}
+
+// parseSize parses a size like 500MB or 1GiB.  K, M and G without B are binary units.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if i == 0 || !ok {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return n * unit, nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/yaegashi/azbill/store"
+)
+
+func TestAtomicFile(t *testing.T) {
+	tests := []struct {
+		abort, keep  bool
+		out, partial string
+	}{
+		{abort: false, keep: false, out: "new", partial: ""},
+		{abort: false, keep: true, out: "new", partial: ""},
+		{abort: true, keep: false, out: "old", partial: ""},
+		{abort: true, keep: true, out: "old", partial: "new"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			dir := tempDir(t)
+			path := filepath.Join(dir, "usage.csv")
+			err := ioutil.WriteFile(path, []byte("old"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			af, err := createAtomicFile(path, tt.keep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = af.Write([]byte("new"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b, _ := ioutil.ReadFile(path); string(b) != "old" {
+				t.Errorf("Output modified before Close: %q", b)
+			}
+			if tt.abort {
+				err = af.Abort()
+			} else {
+				err = af.Close()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.out {
+				t.Errorf("Output mismatch want %q got %q", tt.out, b)
+			}
+			b, err = ioutil.ReadFile(path + ".partial")
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			if string(b) != tt.partial {
+				t.Errorf("Partial mismatch want %q got %q", tt.partial, b)
+			}
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 1
+			if tt.partial != "" {
+				want = 2
+			}
+			if len(files) != want {
+				t.Errorf("File count mismatch want %d got %d", want, len(files))
+			}
+		})
+	}
+}
+
+func TestCompressionFor(t *testing.T) {
+	tests := []struct {
+		o, c string
+	}{
+		{o: "", c: "none"},
+		{o: "usage.csv", c: "none"},
+		{o: "usage.csv.gz", c: "gzip"},
+		{o: "usage.jsonl.ZST", c: "zstd"},
+		{o: "https://account.blob.core.windows.net/container/usage.csv.gz?sv=x.zst", c: "gzip"},
+		{o: "https://account.blob.core.windows.net/container/usage.csv?sv=x.gz", c: "none"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			if c := compressionFor(tt.o); c != tt.c {
+				t.Errorf("Compression mismatch want %q got %q", tt.c, c)
+			}
+		})
+	}
+}
+
+func TestCompressWriter(t *testing.T) {
+	tests := []struct {
+		c string
+	}{
+		{c: "none"},
+		{c: "gzip"},
+		{c: "zstd"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			path := filepath.Join(tempDir(t), "usage.csv")
+			af, err := createAtomicFile(path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, err := newCompressWriter(af, tt.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = w.Write([]byte("data"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = w.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var r io.Reader = f
+			switch tt.c {
+			case "gzip":
+				r, err = gzip.NewReader(f)
+			case "zstd":
+				r, err = zstd.NewReader(f)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "data" {
+				t.Errorf("Data mismatch want %q got %q", "data", b)
+			}
+		})
+	}
+	if _, err := newCompressWriter(nopWriteCloser{ioutil.Discard}, "lz4"); err == nil {
+		t.Errorf("Error expected")
+	}
+}
+
+func TestCompressWriterAbort(t *testing.T) {
+	path := filepath.Join(tempDir(t), "usage.csv.gz")
+	af, err := createAtomicFile(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := newCompressWriter(af, "gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.(aborter).Abort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Output exists after Abort")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s  string
+		n  int64
+		ok bool
+	}{
+		{s: "100", n: 100, ok: true},
+		{s: "1k", n: 1024, ok: true},
+		{s: "500MB", n: 500000000, ok: true},
+		{s: "2GiB", n: 2 << 30, ok: true},
+		{s: "1 gb", n: 1000000000, ok: true},
+		{s: "MB", ok: false},
+		{s: "1.5GB", ok: false},
+		{s: "10xb", ok: false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			n, err := parseSize(tt.s)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("Error expected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.n {
+				t.Errorf("Size mismatch want %d got %d", tt.n, n)
+			}
+		})
+	}
+}
+
+func TestCreateOutputFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no /dev/null and file modes on windows")
+	}
+	w, err := createOutputFile(os.DevNull, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.(*atomicFile); ok {
+		t.Errorf("Atomic file for %s", os.DevNull)
+	}
+	_, err = w.Write([]byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(os.DevNull); err != nil || fi.Mode().IsRegular() {
+		t.Errorf("%s replaced: %v", os.DevNull, err)
+	}
+	tests := []struct {
+		mode os.FileMode
+		want os.FileMode
+	}{
+		{mode: 0, want: 0644},
+		{mode: 0600, want: 0600},
+		{mode: 0664, want: 0664},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			path := filepath.Join(tempDir(t), "usage.csv")
+			if tt.mode != 0 {
+				err := ioutil.WriteFile(path, []byte("old"), tt.mode)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.Chmod(path, tt.mode)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			w, err := createOutputFile(path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := w.(*atomicFile); !ok {
+				t.Errorf("Not atomic file for %s", path)
+			}
+			err = w.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode := fi.Mode().Perm(); mode != tt.want {
+				t.Errorf("Mode mismatch want %v got %v", tt.want, mode)
+			}
+		})
+	}
+}
+
+func TestOpenUnknownCompression(t *testing.T) {
+	app := &App{Compress: "bzip2", ConfigDir: tempDir(t)}
+	if err := app.PersistentPreRunE(nil, nil); err == nil || !strings.Contains(err.Error(), "unknown compression") {
+		t.Errorf("Error mismatch want %q got %v", "unknown compression", err)
+	}
+	dir := tempDir(t)
+	s, err := store.NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "usage.csv")
+	err = ioutil.WriteFile(path, []byte("old"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app = &App{ConfigStore: s, Output: path, Format: "csv", Compress: "bzip2", Quiet: true}
+	if err := app.Open(context.Background()); err == nil {
+		t.Errorf("Error expected")
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "old" {
+		t.Errorf("Output mismatch want %q got %q", "old", b)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("File count mismatch want 1 got %d", len(files))
+	}
+}
+
+// tempDir returns a temporary directory removed at the end of the test.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "azbill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yaegashi/azbill/mapconv"
+)
+
+// partitionUnits are the granularities of date fields in --partition-by.
+var partitionUnits = map[string]string{
+	"year":  "2006",
+	"month": "2006-01",
+	"day":   "2006-01-02",
+}
+
+// partitionDateLayouts are the layouts to parse date fields in.
+var partitionDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02",
+}
+
+var partitionPlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// partitionField is a field to partition records by.
+type partitionField struct {
+	key  string // flattened key like properties.subscriptionId
+	name string // placeholder name, the last segment of key
+	unit string // date granularity [year,month,day] or empty
+}
+
+// parsePartitionBy parses fields separated by commas, each with optional :unit for dates.
+func parsePartitionBy(s string) ([]partitionField, error) {
+	fields := []partitionField{}
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		kv := strings.SplitN(f, ":", 2)
+		if kv[0] == "" {
+			return nil, fmt.Errorf("empty field in --partition-by %q", s)
+		}
+		field := partitionField{key: kv[0], name: kv[0][strings.LastIndex(kv[0], ".")+1:]}
+		if len(kv) == 2 {
+			if _, ok := partitionUnits[kv[1]]; !ok {
+				return nil, fmt.Errorf("unknown date unit %q in --partition-by, should be one of year, month and day", kv[1])
+			}
+			field.unit = kv[1]
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// partitionValue makes s safe as a path segment.
+func partitionValue(s string) string {
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// partitionPath expands the placeholders in tmpl with the fields of the flattened record m.
+// A field is referred to by its key or its name.
+// A date field with a unit also provides {yyyy}, {mm} and {dd} down to the unit.
+func partitionPath(tmpl string, fields []partitionField, m map[string]interface{}) (string, error) {
+	vals := map[string]string{}
+	for _, f := range fields {
+		s := ""
+		if v, ok := m[f.key]; ok && v != nil {
+			s = fmt.Sprint(v)
+		}
+		if f.unit != "" {
+			var t time.Time
+			var err error
+			for _, layout := range partitionDateLayouts {
+				t, err = time.Parse(layout, s)
+				if err == nil {
+					break
+				}
+			}
+			if err != nil {
+				return "", fmt.Errorf("invalid date %q in %s", s, f.key)
+			}
+			s = t.Format(partitionUnits[f.unit])
+			vals["yyyy"] = t.Format("2006")
+			if f.unit != "year" {
+				vals["mm"] = t.Format("01")
+			}
+			if f.unit == "day" {
+				vals["dd"] = t.Format("02")
+			}
+		}
+		s = partitionValue(s)
+		vals[f.key] = s
+		vals[f.name] = s
+	}
+	var err error
+	p := partitionPlaceholder.ReplaceAllStringFunc(tmpl, func(ph string) string {
+		v, ok := vals[ph[1:len(ph)-1]]
+		if !ok && err == nil {
+			err = fmt.Errorf("unknown placeholder %s in --output", ph)
+		}
+		return v
+	})
+	return p, err
+}
+
+// partitionFile is the output file of a partition.
+type partitionFile struct {
+	path  string
+	file  *checksumFile
+	w     io.WriteCloser
+	out   *countWriter
+	csv   *csv.Writer
+	keys  []string
+	rows  int
+	used  int
+	index int
+}
+
+// manifestFile is an entry of the manifest.
+type manifestFile struct {
+	Path   string `json:"path"`
+	Rows   int    `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// manifest lists the output files written.
+type manifest struct {
+	Files []manifestFile `json:"files"`
+	Rows  int            `json:"rows"`
+}
+
+// partitioner routes records to the files of their partitions,
+// keeping at most maxOpen of them open.  If maxRows or maxBytes is set,
+// the file of a partition rolls over to the next one numbered as name-0001.ext.
+type partitioner struct {
+	fields      []partitionField
+	template    string
+	format      string
+	compress    string
+	keepPartial bool
+	maxOpen     int
+	maxRows     int
+	maxBytes    int64
+	manifest    string
+	marshal     func(context.Context, interface{}, ...func(map[string]interface{}) error) error
+	files       map[string]*partitionFile
+	done        []manifestFile
+	open        int
+	clock       int
+}
+
+// rotatedPath inserts the sequence number i before the extensions of path.
+func rotatedPath(path string, i int) string {
+	dir, base := filepath.Split(path)
+	n := len(base)
+	if dot := strings.IndexByte(base[1:], '.'); dot >= 0 {
+		n = dot + 1
+	}
+	return fmt.Sprintf("%s%s-%04d%s", dir, base[:n], i, base[n:])
+}
+
+// rotates reports whether the files roll over.
+func (p *partitioner) rotates() bool {
+	return p.maxRows > 0 || p.maxBytes > 0
+}
+
+// get returns the open file for key, creating it, reopening it or rolling it over as needed.
+func (p *partitioner) get(key string) (*partitionFile, error) {
+	p.clock++
+	pf, ok := p.files[key]
+	if ok && (p.maxRows > 0 && pf.rows >= p.maxRows || p.maxBytes > 0 && pf.out.n >= p.maxBytes) {
+		err := p.finish(pf)
+		if err != nil {
+			return nil, err
+		}
+		pf = &partitionFile{index: pf.index + 1}
+		ok = false
+	}
+	if ok && pf.w != nil {
+		pf.used = p.clock
+		return pf, nil
+	}
+	if p.open >= p.maxOpen {
+		var lru *partitionFile
+		for _, f := range p.files {
+			if f.w != nil && (lru == nil || f.used < lru.used) {
+				lru = f
+			}
+		}
+		err := p.suspend(lru)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ok {
+		err := pf.file.Resume()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if pf == nil {
+			pf = &partitionFile{index: 1}
+		}
+		pf.path = key
+		if p.rotates() {
+			pf.path = rotatedPath(key, pf.index)
+		}
+		err := os.MkdirAll(filepath.Dir(pf.path), 0755)
+		if err != nil {
+			return nil, err
+		}
+		af, err := createAtomicFile(pf.path, p.keepPartial)
+		if err != nil {
+			return nil, err
+		}
+		pf.file = &checksumFile{atomicFile: af, sum: sha256.New()}
+		p.files[key] = pf
+	}
+	w, err := newCompressWriter(pf.file, p.compress)
+	if err != nil {
+		return nil, err
+	}
+	pf.w = w
+	if pf.out == nil {
+		pf.out = &countWriter{}
+	}
+	pf.out.WriteCloser = w
+	if p.format == "csv" {
+		pf.csv = csv.NewWriter(pf.out)
+		pf.csv.UseCRLF = true
+		if !ok {
+			pf.out.Write([]byte{0xef, 0xbb, 0xbf}) // UTF-8 BOM
+		}
+	}
+	pf.used = p.clock
+	p.open++
+	return pf, nil
+}
+
+// suspend finishes the compressed stream of pf and closes its file to be reopened later.
+func (p *partitioner) suspend(pf *partitionFile) error {
+	if pf.csv != nil {
+		pf.csv.Flush()
+		err := pf.csv.Error()
+		if err != nil {
+			return err
+		}
+	}
+	if cw, ok := pf.w.(*compressWriter); ok {
+		err := cw.WriteCloser.Close()
+		if err != nil {
+			return err
+		}
+	}
+	pf.w = nil
+	pf.csv = nil
+	p.open--
+	return pf.file.Suspend()
+}
+
+// finish closes pf and renames it to its path.
+func (p *partitioner) finish(pf *partitionFile) error {
+	if pf.csv != nil {
+		pf.csv.Flush()
+		err := pf.csv.Error()
+		if err != nil {
+			return err
+		}
+	}
+	var w io.WriteCloser = pf.file
+	if pf.w != nil {
+		w = pf.w
+		p.open--
+	}
+	pf.w = nil
+	pf.csv = nil
+	err := w.Close()
+	if err != nil {
+		return err
+	}
+	p.done = append(p.done, manifestFile{
+		Path:   pf.path,
+		Rows:   pf.rows,
+		Bytes:  pf.file.size,
+		SHA256: hex.EncodeToString(pf.file.sum.Sum(nil)),
+	})
+	return nil
+}
+
+// close finishes all the files and writes the manifest if err is nil,
+// or aborts the files not finished yet otherwise.
+// It returns err, or the first error on finishing the files.
+func (p *partitioner) close(err error) error {
+	keys := []string{}
+	for key := range p.files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		pf := p.files[key]
+		if err == nil {
+			err = p.finish(pf)
+			continue
+		}
+		if pf.w != nil {
+			pf.w.(aborter).Abort()
+		} else {
+			pf.file.Abort()
+		}
+	}
+	if err != nil || p.manifest == "" {
+		return err
+	}
+	return p.writeManifest()
+}
+
+// writeManifest writes the manifest listing the files with the paths relative to it.
+func (p *partitioner) writeManifest() error {
+	m := manifest{Files: []manifestFile{}}
+	dir, err := filepath.Abs(filepath.Dir(p.manifest))
+	if err != nil {
+		return err
+	}
+	for _, f := range p.done {
+		path, err := filepath.Abs(f.Path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		f.Path = filepath.ToSlash(rel)
+		m.Files = append(m.Files, f)
+		m.Rows += f.Rows
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	af, err := createAtomicFile(p.manifest, false)
+	if err != nil {
+		return err
+	}
+	_, err = af.Write(append(b, '\n'))
+	if err != nil {
+		af.Abort()
+		return err
+	}
+	return af.Close()
+}
+
+// manifestPath returns the default manifest path for the output template:
+// name.manifest.json for a file, or manifest.json in the directory before the first placeholder.
+func manifestPath(tmpl string) string {
+	if i := strings.IndexByte(tmpl, '{'); i >= 0 {
+		return filepath.Join(filepath.Dir(tmpl[:i]+"x"), "manifest.json")
+	}
+	dir, base := filepath.Split(tmpl)
+	if dot := strings.IndexByte(base[1:], '.'); dot >= 0 {
+		base = base[:dot+1]
+	}
+	return filepath.Join(dir, base+".manifest.json")
+}
+
+// PartitionMarshal writes v to the file of its partition.
+func (app *App) PartitionMarshal(ctx context.Context, v interface{}, mods ...func(map[string]interface{}) error) error {
+	m, err := mapconv.Flatten(v, true)
+	if err != nil {
+		return err
+	}
+	for _, mod := range mods {
+		err = mod(m)
+		if err != nil {
+			return err
+		}
+	}
+	p := app.Partitioner
+	path, err := partitionPath(p.template, p.fields, m)
+	if err != nil {
+		return err
+	}
+	pf, err := p.get(path)
+	if err != nil {
+		return err
+	}
+	app.Writer, app.CSVWriter, app.Keys = pf.out, pf.csv, pf.keys
+	err = p.marshal(ctx, v, mods...)
+	pf.keys = app.Keys
+	app.Writer, app.CSVWriter, app.Keys = nil, nil, nil
+	if err != nil {
+		return err
+	}
+	pf.rows++
+	if pf.csv != nil && p.maxBytes > 0 {
+		// Flush to count the bytes of the record for --max-bytes.
+		pf.csv.Flush()
+		return pf.csv.Error()
+	}
+	return nil
+}
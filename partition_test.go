@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/yaegashi/azbill/store"
+)
+
+func TestPartitionPath(t *testing.T) {
+	m := map[string]interface{}{
+		"properties.date":           "2020-06-01T00:00:00Z",
+		"properties.subscriptionId": "sub",
+		"properties.resourceGroup":  "../rg",
+		"properties.empty":          nil,
+		"tenantId":                  "tenant",
+	}
+	tests := []struct {
+		p, o string
+		x    string
+		ok   bool
+	}{
+		{p: "properties.date:month,properties.subscriptionId", o: "out/{subscriptionId}/{yyyy}-{mm}.csv", x: "out/sub/2020-06.csv", ok: true},
+		{p: "properties.date:day", o: "date={date}/{yyyy}{mm}{dd}.csv", x: "date=2020-06-01/20200601.csv", ok: true},
+		{p: "properties.date:year", o: "{yyyy}/{date}.csv", x: "2020/2020.csv", ok: true},
+		{p: "properties.date:year", o: "{mm}.csv", ok: false},
+		{p: "properties.resourceGroup,properties.empty", o: "{properties.resourceGroup}/{empty}.csv", x: ".._rg/_.csv", ok: true},
+		{p: "tenantId", o: "{tenantId}.csv", x: "tenant.csv", ok: true},
+		{p: "properties.subscriptionId:month", o: "{yyyy}.csv", ok: false},
+		{p: "properties.date:week", ok: false},
+		{p: "properties.date,", ok: false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			fields, err := parsePartitionBy(tt.p)
+			if err == nil {
+				var x string
+				x, err = partitionPath(tt.o, fields, m)
+				if err == nil && x != tt.x {
+					t.Errorf("Path mismatch want %q got %q", tt.x, x)
+				}
+			}
+			if tt.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("Error expected")
+			}
+		})
+	}
+}
+
+type testRecord struct {
+	Properties struct {
+		Date           string `json:"date"`
+		SubscriptionID string `json:"subscriptionId"`
+	} `json:"properties"`
+}
+
+func TestPartitionMarshal(t *testing.T) {
+	dir := tempDir(t)
+	s, err := store.NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{
+		ConfigStore:  s,
+		Format:       "csv",
+		Output:       filepath.Join(dir, "{subscriptionId}", "{yyyy}-{mm}.csv.gz"),
+		PartitionBy:  "properties.date:month,properties.subscriptionId",
+		MaxOpenFiles: 1,
+		Quiet:        true,
+	}
+	ctx := context.Background()
+	err = app.Open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []string{"a/2020-06-01", "b/2020-06-02", "a/2020-06-03", "a/2020-07-01", "b/2020-06-04"} {
+		var rec testRecord
+		fmt.Sscanf(r, "%1s/%s", &rec.Properties.SubscriptionID, &rec.Properties.Date)
+		err = app.Marshal(ctx, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = app.Close(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := "\ufeffproperties.date,properties.subscriptionId\r\n"
+	tests := []struct {
+		f, d string
+	}{
+		{f: "a/2020-06.csv.gz", d: header + "2020-06-01,a\r\n2020-06-03,a\r\n"},
+		{f: "a/2020-07.csv.gz", d: header + "2020-07-01,a\r\n"},
+		{f: "b/2020-06.csv.gz", d: header + "2020-06-02,b\r\n2020-06-04,b\r\n"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			f, err := os.Open(filepath.Join(dir, tt.f))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			r, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.d {
+				t.Errorf("Data mismatch want %q got %q", tt.d, b)
+			}
+		})
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*", ".*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Temporary files left: %v", files)
+	}
+}
+
+func TestPartitionMarshalAbort(t *testing.T) {
+	dir := tempDir(t)
+	s, err := store.NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{
+		ConfigStore:  s,
+		Format:       "json",
+		Output:       filepath.Join(dir, "{subscriptionId}.json"),
+		PartitionBy:  "properties.subscriptionId",
+		MaxOpenFiles: 1,
+		Quiet:        true,
+	}
+	ctx := context.Background()
+	err = app.Open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range []string{"a", "b"} {
+		var rec testRecord
+		rec.Properties.SubscriptionID = sub
+		err = app.Marshal(ctx, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = app.Close(ctx, fmt.Errorf("failed"))
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Files left after abort: %d", len(files))
+	}
+}
+
+func TestRotatedPath(t *testing.T) {
+	tests := []struct {
+		p string
+		i int
+		x string
+	}{
+		{p: "usage.csv", i: 1, x: "usage-0001.csv"},
+		{p: "out/usage.csv.gz", i: 12, x: "out/usage-0012.csv.gz"},
+		{p: "usage", i: 2, x: "usage-0002"},
+		{p: ".usage.csv", i: 3, x: ".usage-0003.csv"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			if x := rotatedPath(filepath.FromSlash(tt.p), tt.i); x != filepath.FromSlash(tt.x) {
+				t.Errorf("Path mismatch want %q got %q", tt.x, x)
+			}
+		})
+	}
+}
+
+func TestManifestPath(t *testing.T) {
+	tests := []struct {
+		p, x string
+	}{
+		{p: "usage.csv", x: "usage.manifest.json"},
+		{p: "out/usage.csv.gz", x: "out/usage.manifest.json"},
+		{p: "out/{subscriptionId}/{yyyy}.csv", x: "out/manifest.json"},
+		{p: "out/sub={subscriptionId}.csv", x: "out/manifest.json"},
+		{p: "{subscriptionId}.csv", x: "manifest.json"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			if x := manifestPath(filepath.FromSlash(tt.p)); x != filepath.FromSlash(tt.x) {
+				t.Errorf("Path mismatch want %q got %q", tt.x, x)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	tests := []struct {
+		r int
+		b string
+		n []int
+	}{
+		{r: 2, n: []int{2, 2, 1}},
+		{r: 5, n: []int{5}},
+		{b: "90", n: []int{3, 2}},
+		{r: 1, b: "1KB", n: []int{1, 1, 1, 1, 1}},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			dir := tempDir(t)
+			s, err := store.NewStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			app := &App{
+				ConfigStore:  s,
+				Format:       "csv",
+				Output:       filepath.Join(dir, "usage.csv"),
+				MaxRows:      tt.r,
+				MaxBytes:     tt.b,
+				MaxOpenFiles: 1,
+				Quiet:        true,
+			}
+			ctx := context.Background()
+			err = app.Open(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 5; i++ {
+				var rec testRecord
+				rec.Properties.SubscriptionID = "sub"
+				rec.Properties.Date = fmt.Sprintf("2020-06-%02d", i+1)
+				err = app.Marshal(ctx, rec)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = app.Close(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadFile(filepath.Join(dir, "usage.manifest.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var m manifest
+			err = json.Unmarshal(b, &m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Rows != 5 {
+				t.Errorf("Rows mismatch want 5 got %d", m.Rows)
+			}
+			if len(m.Files) != len(tt.n) {
+				t.Fatalf("File count mismatch want %d got %d", len(tt.n), len(m.Files))
+			}
+			for j, f := range m.Files {
+				if x := fmt.Sprintf("usage-%04d.csv", j+1); f.Path != x {
+					t.Errorf("Path mismatch want %q got %q", x, f.Path)
+				}
+				if f.Rows != tt.n[j] {
+					t.Errorf("Rows mismatch want %d got %d", tt.n[j], f.Rows)
+				}
+				b, err := ioutil.ReadFile(filepath.Join(dir, f.Path))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasPrefix(string(b), "\ufeffproperties.date,") {
+					t.Errorf("Header missing in %s", f.Path)
+				}
+				if int64(len(b)) != f.Bytes {
+					t.Errorf("Bytes mismatch want %d got %d", len(b), f.Bytes)
+				}
+				if sum := sha256.Sum256(b); hex.EncodeToString(sum[:]) != f.SHA256 {
+					t.Errorf("Checksum mismatch in %s", f.Path)
+				}
+			}
+		})
+	}
+}
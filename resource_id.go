@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+)
+
+// resourceID is an ARM resource ID decomposed by parseResourceID.
+// Case-insensitive parts are normalized to lower case.
+type resourceID struct {
+	SubscriptionID string
+	ResourceGroup  string
+	Provider       string
+	Type           string
+	Name           string
+	ParentType     string
+	ParentName     string
+}
+
+// resourceIDColumns are the columns added by --parse-resource-id in this order.
+var resourceIDColumns = []string{
+	"resource.subscriptionId",
+	"resource.resourceGroup",
+	"resource.provider",
+	"resource.type",
+	"resource.name",
+	"resource.parentType",
+	"resource.parentName",
+}
+
+// parseResourceID decomposes an ARM resource ID like
+// /subscriptions/{id}/resourceGroups/{rg}/providers/{provider}/{type}/{name}[/{childType}/{childName}...].
+// For extension resources, the resource under the last providers is taken.
+// Type is the full resource type like microsoft.compute/virtualmachines/extensions,
+// and ParentName is the names of the ancestors joined by slashes.
+func parseResourceID(s string) (*resourceID, bool) {
+	parts := strings.Split(strings.Trim(s, "/"), "/")
+	if len(parts) < 2 || !strings.EqualFold(parts[0], "subscriptions") || parts[1] == "" {
+		return nil, false
+	}
+	r := &resourceID{SubscriptionID: strings.ToLower(parts[1])}
+	parts = parts[2:]
+	if len(parts) >= 2 && strings.EqualFold(parts[0], "resourceGroups") {
+		r.ResourceGroup = strings.ToLower(parts[1])
+		parts = parts[2:]
+	}
+	last := -1
+	for i := range parts {
+		if strings.EqualFold(parts[i], "providers") {
+			last = i
+		}
+	}
+	if last < 0 {
+		return r, len(parts) == 0
+	}
+	parts = parts[last+1:]
+	if len(parts) < 3 || len(parts)%2 != 1 {
+		return nil, false
+	}
+	r.Provider = strings.ToLower(parts[0])
+	types := []string{r.Provider}
+	names := []string{}
+	for i := 1; i < len(parts); i += 2 {
+		types = append(types, strings.ToLower(parts[i]))
+		names = append(names, parts[i+1])
+	}
+	r.Type = strings.Join(types, "/")
+	r.Name = names[len(names)-1]
+	if len(names) > 1 {
+		r.ParentType = strings.Join(types[:len(types)-1], "/")
+		r.ParentName = strings.Join(names[:len(names)-1], "/")
+	}
+	return r, true
+}
+
+// parseResourceIDMod adds resource.* columns to the flattened map m decomposing
+// properties.resourceId of legacy records or properties.instanceName of modern ones.
+// All columns are added, empty if the ID isn't an ARM resource ID.
+func parseResourceIDMod(m map[string]interface{}) error {
+	var r resourceID
+	for _, key := range []string{"properties.resourceId", "properties.instanceName"} {
+		if s, ok := m[key].(string); ok && s != "" {
+			if id, ok := parseResourceID(s); ok {
+				r = *id
+			}
+			break
+		}
+	}
+	for i, val := range []string{r.SubscriptionID, r.ResourceGroup, r.Provider, r.Type, r.Name, r.ParentType, r.ParentName} {
+		m[resourceIDColumns[i]] = val
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseResourceID(t *testing.T) {
+	tests := []struct {
+		s  string
+		r  resourceID
+		ok bool
+	}{
+		{
+			s:  "/subscriptions/AAAA/resourceGroups/Prod-Web/providers/Microsoft.Compute/virtualMachines/vm1",
+			r:  resourceID{SubscriptionID: "aaaa", ResourceGroup: "prod-web", Provider: "microsoft.compute", Type: "microsoft.compute/virtualmachines", Name: "vm1"},
+			ok: true,
+		},
+		{
+			s:  "/subscriptions/aaaa/resourcegroups/PROD-WEB/providers/Microsoft.Compute/virtualMachines/vm1/extensions/ext1",
+			r:  resourceID{SubscriptionID: "aaaa", ResourceGroup: "prod-web", Provider: "microsoft.compute", Type: "microsoft.compute/virtualmachines/extensions", Name: "ext1", ParentType: "microsoft.compute/virtualmachines", ParentName: "vm1"},
+			ok: true,
+		},
+		{
+			s:  "/subscriptions/aaaa/resourceGroups/rg/providers/Microsoft.Sql/servers/sv/databases/db/backups/b1",
+			r:  resourceID{SubscriptionID: "aaaa", ResourceGroup: "rg", Provider: "microsoft.sql", Type: "microsoft.sql/servers/databases/backups", Name: "b1", ParentType: "microsoft.sql/servers/databases", ParentName: "sv/db"},
+			ok: true,
+		},
+		{
+			s:  "/subscriptions/aaaa/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1/providers/Microsoft.Insights/diagnosticSettings/ds",
+			r:  resourceID{SubscriptionID: "aaaa", ResourceGroup: "rg", Provider: "microsoft.insights", Type: "microsoft.insights/diagnosticsettings", Name: "ds"},
+			ok: true,
+		},
+		{
+			s:  "/subscriptions/aaaa/providers/Microsoft.Capacity/reservationOrders/ro",
+			r:  resourceID{SubscriptionID: "aaaa", Provider: "microsoft.capacity", Type: "microsoft.capacity/reservationorders", Name: "ro"},
+			ok: true,
+		},
+		{s: "/subscriptions/aaaa/resourceGroups/rg", r: resourceID{SubscriptionID: "aaaa", ResourceGroup: "rg"}, ok: true},
+		{s: "/subscriptions/aaaa/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines", ok: false},
+		{s: "/subscriptions/aaaa/resourceGroups/rg/foo", ok: false},
+		{s: "myvm", ok: false},
+		{s: "", ok: false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			r, ok := parseResourceID(tt.s)
+			if ok != tt.ok {
+				t.Fatalf("OK mismatch want %v got %v", tt.ok, ok)
+			}
+			if ok && *r != tt.r {
+				t.Errorf("Resource ID mismatch want %+v got %+v", tt.r, *r)
+			}
+		})
+	}
+}
+
+func TestParseResourceIDMod(t *testing.T) {
+	tests := []struct {
+		m    map[string]interface{}
+		name string
+	}{
+		{m: map[string]interface{}{"properties.resourceId": "/subscriptions/a/resourceGroups/rg/providers/Microsoft.Web/sites/legacy"}, name: "legacy"},
+		{m: map[string]interface{}{"properties.instanceName": "/subscriptions/a/resourceGroups/rg/providers/Microsoft.Web/sites/modern"}, name: "modern"},
+		{m: map[string]interface{}{"properties.resourceId": "classic"}, name: ""},
+		{m: map[string]interface{}{}, name: ""},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			err := parseResourceIDMod(tt.m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range resourceIDColumns {
+				if _, ok := tt.m[key]; !ok {
+					t.Errorf("Column %q missing", key)
+				}
+			}
+			if name := tt.m["resource.name"]; name != tt.name {
+				t.Errorf("Name mismatch want %q got %q", tt.name, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package schema
+
+// builtins are the built-in schema maps in YAML.
+var builtins = map[string]string{
+	"ea-portal-csv": `# Columns of the usage details CSV downloaded from the EA portal
+columns:
+  - {name: AccountOwnerId, from: properties.accountOwnerId}
+  - {name: Account Name, from: properties.accountName}
+  - {name: SubscriptionGuid, from: properties.subscriptionId}
+  - {name: Subscription Name, from: properties.subscriptionName}
+  - {name: Date, from: date, type: date, format: 01/02/2006}
+  - {name: Month, from: date, type: date, format: "01"}
+  - {name: Day, from: date, type: date, format: "02"}
+  - {name: Year, from: date, type: date, format: "2006"}
+  - {name: Product, from: properties.product}
+  - {name: Meter ID, from: meterId}
+  - {name: Meter Category, from: properties.meterDetails.meterCategory}
+  - {name: Meter Sub-Category, from: properties.meterDetails.meterSubCategory}
+  - {name: Meter Name, from: properties.meterDetails.meterName}
+  - {name: Consumed Quantity, from: quantity, type: number}
+  - {name: ResourceRate, from: effectivePrice, type: number}
+  - {name: ExtendedCost, from: cost, type: number}
+  - {name: Resource Location, from: properties.resourceLocation}
+  - {name: Consumed Service, from: properties.consumedService}
+  - {name: Instance ID, from: properties.resourceId}
+  - {name: ServiceInfo1, from: properties.serviceInfo1}
+  - {name: ServiceInfo2, from: properties.serviceInfo2}
+  - {name: AdditionalInfo, from: properties.additionalInfo}
+  - {name: Tags, from: tags}
+  - {name: Department Name, from: properties.invoiceSection}
+  - {name: Cost Center, from: properties.costCenter}
+  - {name: Unit Of Measure, from: properties.meterDetails.unitOfMeasure}
+  - {name: Resource Group, from: properties.resourceGroup}
+`,
+}
@@ -0,0 +1,204 @@
+// Package schema maps flattened records to output columns by schema maps.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v2"
+)
+
+// Column is an output column taken from a flattened key, or a constant value.
+type Column struct {
+	Name string `yaml:"name"`
+	From string `yaml:"from"`
+	// Value is the constant value of the column if From is empty.
+	Value string `yaml:"value"`
+	// Type casts the value to string (default), number, integer, boolean, date or datetime.
+	Type string `yaml:"type"`
+	// Format is the Go time layout for date and datetime.
+	Format string `yaml:"format"`
+}
+
+// Transform converts flattened records to output columns.
+type Transform interface {
+	// Apply returns the output columns of the flattened record m.
+	Apply(m map[string]interface{}) (map[string]interface{}, error)
+	// Keys returns the output column names in order.
+	Keys() []string
+}
+
+// Map is a schema map listing output columns in order.  It implements Transform.
+type Map struct {
+	Columns []Column `yaml:"columns"`
+}
+
+var types = map[string]bool{
+	"":         true,
+	"string":   true,
+	"number":   true,
+	"integer":  true,
+	"boolean":  true,
+	"date":     true,
+	"datetime": true,
+}
+
+// dateLayouts are the layouts to parse date values in.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02",
+	"01/02/2006",
+}
+
+// Parse decodes a schema map in YAML and validates it.
+func Parse(b []byte) (*Map, error) {
+	var sm Map
+	err := yaml.UnmarshalStrict(b, &sm)
+	if err != nil {
+		return nil, err
+	}
+	if len(sm.Columns) == 0 {
+		return nil, fmt.Errorf("no columns in schema map")
+	}
+	names := map[string]bool{}
+	for i, c := range sm.Columns {
+		if c.Name == "" {
+			return nil, fmt.Errorf("column %d: empty name", i+1)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("column %s: duplicate name", c.Name)
+		}
+		names[c.Name] = true
+		if !types[c.Type] {
+			return nil, fmt.Errorf("column %s: unknown type %q", c.Name, c.Type)
+		}
+		if c.Format != "" && c.Type != "date" && c.Type != "datetime" {
+			return nil, fmt.Errorf("column %s: format requires type date or datetime", c.Name)
+		}
+	}
+	return &sm, nil
+}
+
+// Builtin returns the built-in schema map of name.
+func Builtin(name string) (*Map, bool) {
+	b, ok := builtins[name]
+	if !ok {
+		return nil, false
+	}
+	sm, err := Parse([]byte(b))
+	if err != nil {
+		panic(err)
+	}
+	return sm, true
+}
+
+// Builtins returns the names of the built-in schema maps.
+func Builtins() []string {
+	names := []string{}
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Keys returns the column names in order.
+func (sm *Map) Keys() []string {
+	keys := []string{}
+	for _, c := range sm.Columns {
+		keys = append(keys, c.Name)
+	}
+	return keys
+}
+
+// Apply returns the columns of the flattened record m.
+// The columns with missing or empty values are omitted.
+func (sm *Map) Apply(m map[string]interface{}) (map[string]interface{}, error) {
+	out := map[string]interface{}{}
+	for _, c := range sm.Columns {
+		var val interface{} = c.Value
+		if c.From != "" {
+			val = m[c.From]
+		}
+		if val == nil {
+			continue
+		}
+		if s, ok := val.(string); ok && s == "" {
+			continue
+		}
+		v, err := cast(val, c.Type, c.Format)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.Name, err)
+		}
+		out[c.Name] = v
+	}
+	return out, nil
+}
+
+func cast(val interface{}, typ, format string) (interface{}, error) {
+	s, ok := val.(string)
+	if !ok {
+		s = fmt.Sprint(val)
+	}
+	switch typ {
+	case "", "string":
+		if !ok {
+			if _, isMap := val.(map[string]*string); isMap {
+				b, err := json.Marshal(val)
+				if err != nil {
+					return nil, err
+				}
+				return string(b), nil
+			}
+		}
+		return s, nil
+	case "number":
+		d, err := decimal.NewFromString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", s)
+		}
+		return json.Number(d.String()), nil
+	case "integer":
+		d, err := decimal.NewFromString(s)
+		if err != nil || !d.Equal(d.Truncate(0)) {
+			return nil, fmt.Errorf("invalid integer %q", s)
+		}
+		return json.Number(d.String()), nil
+	case "boolean":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean %q", s)
+		}
+		return b, nil
+	case "date", "datetime":
+		t, err := ParseTime(s)
+		if err != nil {
+			return nil, err
+		}
+		if format == "" {
+			format = "2006-01-02"
+			if typ == "datetime" {
+				format = time.RFC3339
+			}
+		}
+		return t.Format(format), nil
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+// ParseTime parses s in the layouts of dates in flattened records.
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, strings.TrimSpace(s))
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
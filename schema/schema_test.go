@@ -0,0 +1,147 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/consumption/mgmt/2019-10-01/consumption"
+	"github.com/Azure/go-autorest/autorest/date"
+	"github.com/shopspring/decimal"
+	"github.com/yaegashi/azbill/mapconv"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		y  string
+		ok bool
+	}{
+		{y: "columns:\n  - {name: Cost, from: properties.cost, type: number}\n", ok: true},
+		{y: "columns:\n  - {name: Date, from: properties.date, type: date, format: 01/02/2006}\n", ok: true},
+		{y: "columns: []\n", ok: false},
+		{y: "columns:\n  - {from: properties.cost}\n", ok: false},
+		{y: "columns:\n  - {name: A, from: a}\n  - {name: A, from: b}\n", ok: false},
+		{y: "columns:\n  - {name: A, from: a, type: float}\n", ok: false},
+		{y: "columns:\n  - {name: A, from: a, format: \"2006\"}\n", ok: false},
+		{y: "columns:\n  - {name: A, form: a}\n", ok: false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			_, err := Parse([]byte(tt.y))
+			if tt.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("Error expected")
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	sm, err := Parse([]byte(`columns:
+  - {name: MeterCategory, from: properties.meterDetails.meterCategory}
+  - {name: Cost, from: properties.cost, type: number}
+  - {name: Quantity, from: properties.quantity, type: integer}
+  - {name: Credit, from: properties.isAzureCreditEligible, type: boolean}
+  - {name: Date, from: properties.date, type: date, format: 01/02/2006}
+  - {name: Start, from: properties.billingPeriodStartDate, type: datetime}
+  - {name: Provider, value: Microsoft}
+  - {name: Tags, from: tags}
+  - {name: Missing, from: properties.missing}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := "prod"
+	m := map[string]interface{}{
+		"properties.meterDetails.meterCategory": "Azure DNS",
+		"properties.cost":                       "0.055159059474412",
+		"properties.quantity":                   "3",
+		"properties.isAzureCreditEligible":      true,
+		"properties.date":                       "2020-06-01T00:00:00Z",
+		"properties.billingPeriodStartDate":     "2020-05-03 00:00:00 +0000 UTC",
+		"tags":                                  map[string]*string{"env": &env},
+	}
+	out, err := sm.Apply(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := `{"Cost":0.055159059474412,"Credit":true,"Date":"06/01/2020","MeterCategory":"Azure DNS","Provider":"Microsoft","Quantity":3,"Start":"2020-05-03T00:00:00Z","Tags":"{\"env\":\"prod\"}"}`
+	if string(b) != j {
+		t.Errorf("Mismatch\nwant: %s\n got: %s", j, b)
+	}
+	keys := fmt.Sprint(sm.Keys())
+	if x := "[MeterCategory Cost Quantity Credit Date Start Provider Tags Missing]"; keys != x {
+		t.Errorf("Keys mismatch want %s got %s", x, keys)
+	}
+}
+
+func TestApplyError(t *testing.T) {
+	tests := []struct {
+		typ, val string
+	}{
+		{typ: "number", val: "x"},
+		{typ: "integer", val: "1.5"},
+		{typ: "boolean", val: "yes"},
+		{typ: "date", val: "June 1"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			sm := &Map{Columns: []Column{{Name: "A", From: "a", Type: tt.typ}}}
+			if _, err := sm.Apply(map[string]interface{}{"a": tt.val}); err == nil {
+				t.Errorf("Error expected")
+			}
+		})
+	}
+}
+
+func TestBuiltin(t *testing.T) {
+	for _, name := range Builtins() {
+		if _, ok := Builtin(name); !ok {
+			t.Errorf("Builtin %s not found", name)
+		}
+	}
+	if _, ok := Builtin("none"); ok {
+		t.Errorf("Builtin none found")
+	}
+}
+
+func TestBuiltinLegacyUsageDetail(t *testing.T) {
+	type legacyUsageDetail consumption.LegacyUsageDetail
+	cost := decimal.RequireFromString("1.5")
+	category := "Azure DNS"
+	v := legacyUsageDetail{
+		Kind: consumption.KindLegacy,
+		LegacyUsageDetailProperties: &consumption.LegacyUsageDetailProperties{
+			Date:         &date.Time{Time: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)},
+			Cost:         &cost,
+			Quantity:     &cost,
+			MeterDetails: &consumption.MeterDetailsResponse{MeterCategory: &category},
+		},
+	}
+	m, err := mapconv.Flatten(v, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, _ := Builtin("ea-portal-csv")
+	out, err := sm.Apply(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, x := range map[string]interface{}{
+		"Date":              "06/01/2020",
+		"ExtendedCost":      json.Number("1.5"),
+		"Consumed Quantity": json.Number("1.5"),
+		"Meter Category":    "Azure DNS",
+	} {
+		if out[k] != x {
+			t.Errorf("%s mismatch want %v got %v", k, x, out[k])
+		}
+	}
+}
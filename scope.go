@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// usageDetailsScopeForms are the ARM scope shapes accepted by the consumption API.
+// The billing period suffix is allowed only on the forms marked with period.
+var usageDetailsScopeForms = []struct {
+	form   string
+	period bool
+}{
+	{"subscriptions/{subscriptionId}", true},
+	{"subscriptions/{subscriptionId}/resourceGroups/{resourceGroupName}", false},
+	{"providers/Microsoft.Billing/billingAccounts/{billingAccountId}", true},
+	{"providers/Microsoft.Billing/billingAccounts/{billingAccountId}/departments/{departmentId}", true},
+	{"providers/Microsoft.Billing/billingAccounts/{billingAccountId}/enrollmentAccounts/{enrollmentAccountId}", true},
+	{"providers/Microsoft.Billing/billingAccounts/{billingAccountId}/billingProfiles/{billingProfileId}", false},
+	{"providers/Microsoft.Billing/billingAccounts/{billingAccountId}/billingProfiles/{billingProfileId}/invoiceSections/{invoiceSectionId}", false},
+	{"providers/Microsoft.Billing/billingAccounts/{billingAccountId}/customers/{customerId}", false},
+	{"providers/Microsoft.Billing/departments/{departmentId}", true},
+	{"providers/Microsoft.Billing/enrollmentAccounts/{enrollmentAccountId}", true},
+	{"providers/Microsoft.Management/managementGroups/{managementGroupId}", true},
+}
+
+const usageDetailsScopePeriod = "providers/Microsoft.Billing/billingPeriods/{billingPeriodName}"
+
+var (
+	scopeParamRegexp       = regexp.MustCompile(`\{[^}]+\}`)
+	usageDetailsScopeRegex = compileScopeForms()
+)
+
+func compileScopeForms() *regexp.Regexp {
+	alts := []string{}
+	for _, f := range usageDetailsScopeForms {
+		alt := scopeFormPattern(f.form)
+		if f.period {
+			alt += "(/" + scopeFormPattern(usageDetailsScopePeriod) + ")?"
+		}
+		alts = append(alts, alt)
+	}
+	return regexp.MustCompile(`(?i)^(` + strings.Join(alts, "|") + `)$`)
+}
+
+func scopeFormPattern(form string) string {
+	parts := scopeParamRegexp.Split(form, -1)
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return strings.Join(parts, `[^/]+`)
+}
+
+// scopeSegment checks that val given by flag is a single scope path segment.
+func scopeSegment(flag, val string) error {
+	if val == "." || val == ".." || strings.Contains(val, "/") {
+		return fmt.Errorf("invalid %s: %q", flag, val)
+	}
+	return nil
+}
+
+// joinScope joins scope elements with slashes regardless of the host OS,
+// dropping empty segments and rejecting "." and ".." segments.
+func joinScope(elem ...string) (string, error) {
+	segs := []string{}
+	for _, e := range elem {
+		for _, seg := range strings.Split(e, "/") {
+			switch seg {
+			case "":
+				continue
+			case ".", "..":
+				return "", fmt.Errorf("invalid scope segment %q", seg)
+			}
+			segs = append(segs, seg)
+		}
+	}
+	return strings.Join(segs, "/"), nil
+}
+
+// validateScope checks scope against usageDetailsScopeForms and returns it
+// without the leading slash, or an error listing the valid forms.
+func validateScope(scope string) (string, error) {
+	scope = strings.Trim(scope, "/")
+	if usageDetailsScopeRegex.MatchString(scope) {
+		return scope, nil
+	}
+	msg := fmt.Sprintf("invalid scope %q, valid forms are:", scope)
+	for _, f := range usageDetailsScopeForms {
+		msg += "\n  " + f.form
+		if f.period {
+			msg += "[/" + usageDetailsScopePeriod + "]"
+		}
+	}
+	return "", fmt.Errorf("%s", msg)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBuildScope(t *testing.T) {
+	tests := []struct {
+		s, a, p, S, g string
+		o, e          string
+	}{
+		{S: "sub", o: "subscriptions/sub"},
+		{S: "sub", g: "rg", o: "subscriptions/sub/resourceGroups/rg"},
+		{S: "sub", p: "202006", o: "subscriptions/sub/providers/Microsoft.Billing/billingPeriods/202006"},
+		{a: "acct", p: "202006", o: "providers/Microsoft.Billing/billingAccounts/acct/providers/Microsoft.Billing/billingPeriods/202006"},
+		{g: "rg", e: "--resource-group requires --subscription"},
+		{S: "sub", g: "rg", p: "202006", e: "invalid scope"},
+		{a: "acct", S: "sub", e: "invalid scope"},
+		{S: "sub", g: "..", e: "invalid --resource-group"},
+		{S: "sub/resourceGroups", g: "rg", e: "invalid --subscription"},
+		{s: "subscriptions/sub/resourceGroups/rg/..", e: "invalid scope segment"},
+		{s: "/subscriptions/sub/", o: "subscriptions/sub"},
+		{
+			s: "/providers/Microsoft.Management/managementGroups/mg",
+			p: "202006",
+			o: "providers/Microsoft.Management/managementGroups/mg/providers/Microsoft.Billing/billingPeriods/202006",
+		},
+		{e: "no scope specified"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			app := &AppUsageDetails{Scope: tt.s, BillingAccount: tt.a, BillingPeriod: tt.p, Subscription: tt.S, ResourceGroup: tt.g}
+			o, err := app.buildScope()
+			if tt.e != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.e) {
+					t.Errorf("Error mismatch want %q got %v", tt.e, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.o != o {
+				t.Errorf("Scope mismatch want %q got %q", tt.o, o)
+			}
+		})
+	}
+}
+
+func TestValidateScopeError(t *testing.T) {
+	_, err := validateScope("subscriptions")
+	if err == nil {
+		t.Fatal("Error expected")
+	}
+	for _, f := range usageDetailsScopeForms {
+		if !strings.Contains(err.Error(), "\n  "+f.form) {
+			t.Errorf("Valid form %q not listed in %q", f.form, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Backend reads and writes data at URLs of the schemes it is registered for in Store.Backends.
+// A version is an opaque string identifying the data read, compared by WriteFile
+// to detect concurrent modifications.  RemoveFile returns os.ErrNotExist for missing data.
+type Backend interface {
+	ReadFile(u *url.URL) ([]byte, string, error)
+	WriteFile(u *url.URL, b []byte, m os.FileMode, version string) error
+	RemoveFile(u *url.URL) error
+}
+
+// FileBackend stores data in local files, for local paths and file:// URLs.
+// Versions are SHA-256 digests of the contents.  Writes are done under a lock file
+// by renaming a temporary file, so that concurrent readers see either the old or new contents.
+type FileBackend struct{}
+
+func (fb *FileBackend) path(u *url.URL) string {
+	if u.Scheme == "" {
+		return u.Path
+	}
+	p := u.Path
+	if runtime.GOOS == "windows" && len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+func (fb *FileBackend) ReadFile(u *url.URL) ([]byte, string, error) {
+	b, err := ioutil.ReadFile(fb.path(u))
+	if err != nil {
+		return nil, "", err
+	}
+	return b, digest(b), nil
+}
+
+func (fb *FileBackend) WriteFile(u *url.URL, b []byte, m os.FileMode, version string) error {
+	p := fb.path(u)
+	unlock, err := lockFile(p)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if version != "" {
+		cur, err := ioutil.ReadFile(p)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err != nil || digest(cur) != version {
+			return ErrConflict
+		}
+	}
+	return writeFileAtomic(p, b, m)
+}
+
+// writeFileAtomic writes b to a temporary file in the directory of path
+// and renames it to path, so that readers never see partial contents.
+func writeFileAtomic(path string, b []byte, m os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Chmod(m)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (fb *FileBackend) RemoveFile(u *url.URL) error {
+	return os.Remove(fb.path(u))
+}
+
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// hasQuery reports whether u has any of the query parameters case-insensitively.
+func hasQuery(u *url.URL, keys ...string) bool {
+	for k := range u.Query() {
+		for _, key := range keys {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
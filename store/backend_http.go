@@ -0,0 +1,122 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// HTTPBackend stores data at http and https URLs with GET, PUT and DELETE.
+// Azure Blob Storage SAS URLs and S3-compatible presigned URLs get the requests
+// their services expect; other URLs get plain requests with Header added.
+// S3-compatible presigned URLs are signed for a single method, so that they are
+// read-only locations for files like client secrets and certificates.
+// Versions are ETags, and conditional writes use If-Match.
+type HTTPBackend struct {
+	// Client is used for the requests, http.DefaultClient if nil.
+	Client *http.Client
+	// Header is added to the requests to generic HTTP servers.
+	Header http.Header
+}
+
+func (hb *HTTPBackend) client() *http.Client {
+	if hb.Client != nil {
+		return hb.Client
+	}
+	return http.DefaultClient
+}
+
+func isAzureBlob(u *url.URL) bool {
+	return u.Scheme == "https" && strings.HasSuffix(u.Host, ".blob.core.windows.net")
+}
+
+func isS3Presigned(u *url.URL) bool {
+	return hasQuery(u, "X-Amz-Signature", "Signature")
+}
+
+func (hb *HTTPBackend) do(method string, u *url.URL, b []byte, version string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case isAzureBlob(u):
+		if method == http.MethodPut {
+			req.Header.Set("x-ms-blob-type", "BlockBlob")
+		}
+	case isS3Presigned(u):
+		// Presigned URLs carry all the authentication in the query.
+	default:
+		for k, vs := range hb.Header {
+			for _, v := range vs {
+				req.Header.Add(k, v)
+			}
+		}
+	}
+	if version != "" {
+		req.Header.Set("If-Match", version)
+	}
+	return hb.client().Do(req)
+}
+
+func (hb *HTTPBackend) ReadFile(u *url.URL) ([]byte, string, error) {
+	res, err := hb.do(http.MethodGet, u, nil, "")
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, "", os.ErrNotExist
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s", res.Status)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return b, res.Header.Get("ETag"), nil
+}
+
+// errPresignedReadOnly is returned on writing or removing at S3-compatible presigned URLs.
+var errPresignedReadOnly = fmt.Errorf("S3 presigned URL is a read-only store location")
+
+func (hb *HTTPBackend) WriteFile(u *url.URL, b []byte, m os.FileMode, version string) error {
+	if isS3Presigned(u) {
+		return errPresignedReadOnly
+	}
+	res, err := hb.do(http.MethodPut, u, b, version)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	case http.StatusPreconditionFailed:
+		return ErrConflict
+	}
+	return fmt.Errorf("%s", res.Status)
+}
+
+func (hb *HTTPBackend) RemoveFile(u *url.URL) error {
+	if isS3Presigned(u) {
+		return errPresignedReadOnly
+	}
+	res, err := hb.do(http.MethodDelete, u, nil, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return os.ErrNotExist
+	}
+	return fmt.Errorf("%s", res.Status)
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// DefaultBlockSize is the size of blocks staged by BlobWriter.
+const DefaultBlockSize = 4 << 20
+
+// BlobWriter streams data to an Azure Blob Storage block blob.
+// Every BlockSize bytes written are staged by Put Block,
+// and Close commits them by Put Block List.
+// Until then the blob is left intact, and Abort discards the staged blocks.
+type BlobWriter struct {
+	BlockSize int
+	hb        *HTTPBackend
+	u         *url.URL
+	buf       []byte
+	blocks    []string
+}
+
+// NewBlobWriter returns a BlobWriter for an Azure Blob Storage URL with SAS.
+func (hb *HTTPBackend) NewBlobWriter(u *url.URL) (*BlobWriter, error) {
+	if !isAzureBlob(u) {
+		return nil, fmt.Errorf("not an Azure Blob Storage URL: %s", u.Host)
+	}
+	return &BlobWriter{BlockSize: DefaultBlockSize, hb: hb, u: u}, nil
+}
+
+func (bw *BlobWriter) Write(p []byte) (int, error) {
+	bw.buf = append(bw.buf, p...)
+	for len(bw.buf) >= bw.BlockSize {
+		err := bw.putBlock(bw.buf[:bw.BlockSize])
+		if err != nil {
+			return 0, err
+		}
+		bw.buf = bw.buf[bw.BlockSize:]
+	}
+	return len(p), nil
+}
+
+// Close stages the remaining data and commits all the blocks to the blob.
+func (bw *BlobWriter) Close() error {
+	if len(bw.buf) > 0 || len(bw.blocks) == 0 {
+		err := bw.putBlock(bw.buf)
+		if err != nil {
+			return err
+		}
+		bw.buf = nil
+	}
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for _, id := range bw.blocks {
+		fmt.Fprintf(&body, "<Latest>%s</Latest>", id)
+	}
+	body.WriteString(`</BlockList>`)
+	return bw.put("blocklist", "", body.Bytes())
+}
+
+// Abort discards the data without committing.
+// The service garbage-collects the staged blocks.
+func (bw *BlobWriter) Abort() error {
+	bw.buf = nil
+	bw.blocks = nil
+	return nil
+}
+
+func (bw *BlobWriter) putBlock(b []byte) error {
+	// Block IDs must be of the same length in a blob.
+	id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", len(bw.blocks))))
+	err := bw.put("block", id, b)
+	if err != nil {
+		return err
+	}
+	bw.blocks = append(bw.blocks, id)
+	return nil
+}
+
+func (bw *BlobWriter) put(comp, id string, b []byte) error {
+	u := *bw.u
+	q := u.Query()
+	q.Set("comp", comp)
+	if id != "" {
+		q.Set("blockid", id)
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	res, err := bw.hb.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%s: %s", comp, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// blockBlobStandIn is a minimal Azure Blob Storage stand-in supporting Put Block and Put Block List.
+type blockBlobStandIn struct {
+	mu     sync.Mutex
+	staged map[string][]byte
+	data   []byte
+	puts   int
+}
+
+func (bs *blockBlobStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, _ := ioutil.ReadAll(r.Body)
+	q := r.URL.Query()
+	switch q.Get("comp") {
+	case "block":
+		if bs.staged == nil {
+			bs.staged = map[string][]byte{}
+		}
+		bs.staged[q.Get("blockid")] = b
+		bs.puts++
+	case "blocklist":
+		var list struct {
+			Latest []string
+		}
+		if err := xml.Unmarshal(b, &list); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		bs.data = nil
+		for _, id := range list.Latest {
+			bs.data = append(bs.data, bs.staged[id]...)
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func TestBlobWriter(t *testing.T) {
+	tests := []struct {
+		d    string
+		n    int
+		puts int
+	}{
+		{d: "", n: 4, puts: 1},
+		{d: "abc", n: 4, puts: 1},
+		{d: "abcdefgh", n: 4, puts: 2},
+		{d: "abcdefghij", n: 4, puts: 3},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			bs := &blockBlobStandIn{}
+			ts := httptest.NewTLSServer(bs)
+			defer ts.Close()
+			hb := &HTTPBackend{Client: newBlobClient(ts)}
+			u, _ := url.Parse("https://account.blob.core.windows.net/container/usage.csv?sig=secret")
+			bw, err := hb.NewBlobWriter(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bw.BlockSize = tt.n
+			for _, s := range strings.SplitAfter(tt.d, "c") {
+				_, err = bw.Write([]byte(s))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if bs.data != nil {
+				t.Errorf("Data committed before Close")
+			}
+			err = bw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(bs.data) != tt.d {
+				t.Errorf("Data mismatch want %q got %q", tt.d, bs.data)
+			}
+			if bs.puts != tt.puts {
+				t.Errorf("Put Block count mismatch want %d got %d", tt.puts, bs.puts)
+			}
+		})
+	}
+}
+
+func TestNewBlobWriterNotBlob(t *testing.T) {
+	hb := &HTTPBackend{}
+	u, _ := url.Parse("https://example.com/usage.csv")
+	if _, err := hb.NewBlobWriter(u); err == nil {
+		t.Errorf("Error expected")
+	}
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	saltSize = 16
+	keySize  = 32
+	scryptN  = 1 << 15
+	scryptR  = 8
+	scryptP  = 1
+)
+
+// cryptMagic prefixes data encrypted by Encrypt.
+var cryptMagic = []byte("AZBILL-ENC1\n")
+
+// IsEncrypted reports whether b was encrypted by Encrypt.
+func IsEncrypted(b []byte) bool {
+	return bytes.HasPrefix(b, cryptMagic)
+}
+
+// Encrypt encrypts b with AES-256-GCM using a key derived from passphrase by scrypt.
+// The output is the magic, the salt, the nonce and the sealed data in this order.
+func Encrypt(passphrase, b []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	_, err := io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	out := append(append(append([]byte{}, cryptMagic...), salt...), nonce...)
+	return aead.Seal(out, nonce, b, cryptMagic), nil
+}
+
+// Decrypt decrypts b encrypted by Encrypt.
+func Decrypt(passphrase, b []byte) ([]byte, error) {
+	if !IsEncrypted(b) {
+		return nil, fmt.Errorf("not encrypted data")
+	}
+	b = b[len(cryptMagic):]
+	if len(b) < saltSize {
+		return nil, fmt.Errorf("truncated encrypted data")
+	}
+	aead, err := newAEAD(passphrase, b[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	b = b[saltSize:]
+	if len(b) < aead.NonceSize() {
+		return nil, fmt.Errorf("truncated encrypted data")
+	}
+	out, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], cryptMagic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: wrong token key or corrupted data")
+	}
+	return out, nil
+}
+
+func newAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
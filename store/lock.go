@@ -0,0 +1,42 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	lockTimeout = 30 * time.Second
+	lockStale   = time.Minute
+	lockPoll    = 50 * time.Millisecond
+)
+
+// lockFile creates the lock file for path and returns a function to remove it.
+// A lock file older than lockStale is considered left by a crashed process and removed.
+func lockFile(path string) (func(), error) {
+	lock := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	removed := false
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		// Remove a stale lock only once.  If another process takes the lock
+		// between the removal and our retry, its lock is fresh and we wait for it.
+		if fi, err := os.Stat(lock); err == nil && !removed && time.Since(fi.ModTime()) > lockStale {
+			os.Remove(lock)
+			removed = true
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock file %s", lock)
+		}
+		time.Sleep(lockPoll)
+	}
+}
@@ -1,10 +1,8 @@
 package store
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -15,8 +13,17 @@ import (
 
 type Store struct {
 	Dir string
+	// HTTP is the backend for http and https URLs.
+	HTTP *HTTPBackend
+	// Backends maps URL schemes to their backends.  Local paths use the "file" backend.
+	Backends map[string]Backend
+	// Passphrase, if set, encrypts data written by WriteFile and decrypts encrypted data read by ReadFile.
+	Passphrase []byte
 }
 
+// ErrConflict is returned by WriteFileVersion when the location was modified since it was read.
+var ErrConflict = errors.New("location was modified concurrently")
+
 func NewStore(dir string) (*Store, error) {
 	dir, err := homedir.Expand(dir)
 	if err != nil {
@@ -25,7 +32,17 @@ func NewStore(dir string) (*Store, error) {
 	if !strings.HasSuffix(dir, string(os.PathSeparator)) {
 		dir += string(os.PathSeparator)
 	}
-	return &Store{Dir: dir}, nil
+	h := &HTTPBackend{}
+	s := &Store{
+		Dir:  dir,
+		HTTP: h,
+		Backends: map[string]Backend{
+			"file":  &FileBackend{},
+			"http":  h,
+			"https": h,
+		},
+	}
+	return s, nil
 }
 
 func (s *Store) Location(loc string, redact bool) (string, bool) {
@@ -42,68 +59,77 @@ func (s *Store) Location(loc string, redact bool) (string, bool) {
 	return u.String(), true
 }
 
-func (s *Store) ReadFile(loc string) ([]byte, error) {
+// backend returns the backend and the URL for loc.  Local paths are returned
+// as URLs with an empty scheme for the "file" backend.
+func (s *Store) backend(loc string) (Backend, *url.URL, error) {
 	aLoc, isURL := s.Location(loc, false)
-	if isURL {
-		u, err := url.Parse(aLoc)
-		if err != nil {
-			return nil, err
-		}
-		switch u.Scheme {
-		case "https", "http":
-			res, err := http.Get(aLoc)
+	if !isURL {
+		if strings.HasPrefix(aLoc, s.Dir) {
+			err := os.MkdirAll(filepath.Dir(s.Dir), 0755)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
-			defer res.Body.Close()
-			if res.StatusCode != http.StatusOK {
-				return nil, fmt.Errorf("%s", res.Status)
-			}
-			b, err := ioutil.ReadAll(res.Body)
-			if err != nil {
-				return nil, err
-			}
-			return b, nil
 		}
-		return nil, fmt.Errorf("Unsupported location to load")
+		return s.Backends["file"], &url.URL{Path: aLoc}, nil
 	}
-	return ioutil.ReadFile(aLoc)
+	u, err := url.Parse(aLoc)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, ok := s.Backends[u.Scheme]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported location scheme %q", u.Scheme)
+	}
+	return b, u, nil
+}
+
+func (s *Store) ReadFile(loc string) ([]byte, error) {
+	b, _, err := s.ReadFileVersion(loc)
+	return b, err
+}
+
+// ReadFileVersion reads loc and returns its version to pass to WriteFileVersion.
+func (s *Store) ReadFileVersion(loc string) ([]byte, string, error) {
+	be, u, err := s.backend(loc)
+	if err != nil {
+		return nil, "", err
+	}
+	b, version, err := be.ReadFile(u)
+	if err != nil || !IsEncrypted(b) {
+		return b, version, err
+	}
+	if s.Passphrase == nil {
+		return nil, "", fmt.Errorf("encrypted data requires a passphrase")
+	}
+	b, err = Decrypt(s.Passphrase, b)
+	return b, version, err
 }
 
 func (s *Store) WriteFile(loc string, b []byte, m os.FileMode) error {
-	aLoc, isURL := s.Location(loc, false)
-	if isURL {
-		u, err := url.Parse(aLoc)
+	return s.WriteFileVersion(loc, b, m, "")
+}
+
+// WriteFileVersion writes b to loc if loc is still at version returned by ReadFileVersion,
+// otherwise returns ErrConflict.  An empty version writes unconditionally.
+func (s *Store) WriteFileVersion(loc string, b []byte, m os.FileMode, version string) error {
+	if s.Passphrase != nil {
+		var err error
+		b, err = Encrypt(s.Passphrase, b)
 		if err != nil {
 			return err
 		}
-		switch u.Scheme {
-		case "https":
-			if strings.HasSuffix(u.Host, ".blob.core.windows.net") {
-				cli := &http.Client{}
-				req, err := http.NewRequest(http.MethodPut, aLoc, bytes.NewBuffer(b))
-				if err != nil {
-					return err
-				}
-				req.Header.Set("x-ms-blob-type", "BlockBlob")
-				res, err := cli.Do(req)
-				if err != nil {
-					return err
-				}
-				defer res.Body.Close()
-				if res.StatusCode != http.StatusCreated {
-					return fmt.Errorf("%s", res.Status)
-				}
-				return nil
-			}
-		}
-		return fmt.Errorf("Unsupported location to save")
 	}
-	if strings.HasPrefix(aLoc, s.Dir) {
-		err := os.MkdirAll(filepath.Dir(s.Dir), 0755)
-		if err != nil {
-			return err
-		}
+	be, u, err := s.backend(loc)
+	if err != nil {
+		return err
+	}
+	return be.WriteFile(u, b, m, version)
+}
+
+func (s *Store) RemoveFile(loc string) error {
+	be, u, err := s.backend(loc)
+	if err != nil {
+		return err
 	}
-	return ioutil.WriteFile(aLoc, b, m)
+	return be.RemoveFile(u)
 }
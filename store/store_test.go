@@ -0,0 +1,491 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRemoveFile(t *testing.T) {
+	dir := tempDir(t)
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "token.json"), []byte("{}"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.RemoveFile("token.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "token.json")); !os.IsNotExist(err) {
+		t.Errorf("File not removed: %v", err)
+	}
+	err = s.RemoveFile("token.json")
+	if !os.IsNotExist(err) {
+		t.Errorf("Not exist error expected, got %v", err)
+	}
+	err = s.RemoveFile("ftp://example.com/token.json")
+	if err == nil {
+		t.Errorf("Error expected")
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	dir := tempDir(t)
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.WriteFile("plain.json", []byte("plain"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Passphrase = []byte("secret")
+	err = s.WriteFile("token.json", []byte("token"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "token.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(raw) || bytes.Contains(raw, []byte("token")) {
+		t.Errorf("Data not encrypted: %q", raw)
+	}
+	tests := []struct {
+		p    []byte
+		i, o string
+		ok   bool
+	}{
+		{p: []byte("secret"), i: "token.json", o: "token", ok: true},
+		{p: []byte("secret"), i: "plain.json", o: "plain", ok: true},
+		{p: []byte("wrong"), i: "token.json", ok: false},
+		{p: nil, i: "token.json", ok: false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			s.Passphrase = tt.p
+			b, err := s.ReadFile(tt.i)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("Error expected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.o {
+				t.Errorf("Data mismatch want %q got %q", tt.o, b)
+			}
+		})
+	}
+}
+
+func TestWriteFileVersionLocal(t *testing.T) {
+	s, err := NewStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.WriteFile("token.json", []byte("1"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, v1, err := s.ReadFileVersion("token.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.WriteFileVersion("token.json", []byte("2"), 0600, v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.WriteFileVersion("token.json", []byte("3"), 0600, v1)
+	if err != ErrConflict {
+		t.Errorf("Conflict expected, got %v", err)
+	}
+	b, _, err := s.ReadFileVersion("token.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "2" {
+		t.Errorf("Data mismatch want %q got %q", "2", b)
+	}
+}
+
+func TestWriteFileVersionConcurrent(t *testing.T) {
+	s, err := NewStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.WriteFile("counter", []byte("0"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				b, v, err := s.ReadFileVersion("counter")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				c, err := strconv.Atoi(string(b))
+				if err != nil {
+					t.Errorf("Partial counter read: %v", err)
+					return
+				}
+				err = s.WriteFileVersion("counter", []byte(strconv.Itoa(c+1)), 0600, v)
+				if err == ErrConflict {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+		}()
+	}
+	wg.Wait()
+	b, err := s.ReadFile("counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != strconv.Itoa(n) {
+		t.Errorf("Counter mismatch want %d got %s", n, b)
+	}
+}
+
+// blobStandIn is a minimal Azure Blob Storage stand-in supporting ETag and If-Match.
+type blobStandIn struct {
+	mu    sync.Mutex
+	data  []byte
+	etag  int
+	found bool
+}
+
+func (bs *blobStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	etag := fmt.Sprintf(`"%d"`, bs.etag)
+	switch r.Method {
+	case http.MethodGet:
+		if !bs.found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write(bs.data)
+	case http.MethodPut:
+		if m := r.Header.Get("If-Match"); m != "" && (!bs.found || m != etag) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		bs.data, _ = ioutil.ReadAll(r.Body)
+		bs.etag++
+		bs.found = true
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		bs.found = false
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// newBlobClient returns an http.Client sending all requests to ts.
+func newBlobClient(ts *httptest.Server) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("tcp", ts.Listener.Addr().String())
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+}
+
+func TestWriteFileConcurrentRead(t *testing.T) {
+	s, err := NewStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := [][]byte{bytes.Repeat([]byte("a"), 1<<20), bytes.Repeat([]byte("b"), 1<<20)}
+	err = s.WriteFile("data", contents[0], 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			b, err := s.ReadFile("data")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(b, contents[0]) && !bytes.Equal(b, contents[1]) {
+				t.Errorf("Partial read of %d bytes", len(b))
+				return
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		_, v, err := s.ReadFileVersion("data")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.WriteFileVersion("data", contents[(i+1)%2], 0600, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.WriteFile("data", contents[i%2], 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestWriteFileVersionBlob(t *testing.T) {
+	ts := httptest.NewTLSServer(&blobStandIn{})
+	defer ts.Close()
+	s, err := NewStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.HTTP.Client = newBlobClient(ts)
+	loc := "https://account.blob.core.windows.net/container/token.json?sig=secret"
+	err = s.WriteFile(loc, []byte("1"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, v1, err := s.ReadFileVersion(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.WriteFileVersion(loc, []byte("2"), 0600, v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.WriteFileVersion(loc, []byte("3"), 0600, v1)
+	if err != ErrConflict {
+		t.Errorf("Conflict expected, got %v", err)
+	}
+	b, err := s.ReadFile(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "2" {
+		t.Errorf("Data mismatch want %q got %q", "2", b)
+	}
+	err = s.RemoveFile(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReadFile(loc); err == nil {
+		t.Errorf("Error expected after removal")
+	}
+}
+
+func TestFileURL(t *testing.T) {
+	dir := tempDir(t)
+	s, err := NewStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.ToSlash(filepath.Join(dir, "token.json"))
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	loc := "file://" + p
+	err = s.WriteFile(loc, []byte("1"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "token.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "1" {
+		t.Errorf("Data mismatch want %q got %q", "1", b)
+	}
+	_, v1, err := s.ReadFileVersion(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.WriteFileVersion(loc, []byte("2"), 0600, v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.WriteFileVersion(loc, []byte("3"), 0600, v1)
+	if err != ErrConflict {
+		t.Errorf("Conflict expected, got %v", err)
+	}
+	err = s.RemoveFile(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReadFile(loc); !os.IsNotExist(err) {
+		t.Errorf("Not exist error expected, got %v", err)
+	}
+}
+
+func TestUnsupportedScheme(t *testing.T) {
+	s, err := NewStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReadFile("ftp://example.com/token.json"); err == nil {
+		t.Errorf("Error expected")
+	}
+}
+
+func TestHTTPBackendHeaders(t *testing.T) {
+	tests := []struct {
+		loc      string
+		h        string
+		blobType string
+		readOnly bool
+	}{
+		{loc: "https://account.blob.core.windows.net/container/token.json?sig=secret", blobType: "BlockBlob"},
+		{loc: "https://bucket.s3.amazonaws.com/token.json?X-Amz-Signature=secret", readOnly: true},
+		{loc: "https://minio.example.com/bucket/token.json?x-amz-signature=secret", readOnly: true},
+		{loc: "https://example.com/token.json", h: "Bearer token"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			var h, blobType string
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				h = r.Header.Get("Authorization")
+				blobType = r.Header.Get("x-ms-blob-type")
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer ts.Close()
+			s, err := NewStore(tempDir(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.HTTP.Client = newBlobClient(ts)
+			s.HTTP.Header = http.Header{"Authorization": {"Bearer token"}}
+			if tt.readOnly {
+				if err := s.WriteFile(tt.loc, []byte("1"), 0600); err == nil {
+					t.Errorf("Write error expected")
+				}
+				if err := s.RemoveFile(tt.loc); err == nil {
+					t.Errorf("Remove error expected")
+				}
+				_, err = s.ReadFile(tt.loc)
+			} else {
+				err = s.WriteFile(tt.loc, []byte("1"), 0600)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h != tt.h {
+				t.Errorf("Authorization mismatch want %q got %q", tt.h, h)
+			}
+			if blobType != tt.blobType {
+				t.Errorf("Blob type mismatch want %q got %q", tt.blobType, blobType)
+			}
+		})
+	}
+}
+
+func TestWriteFileVersionGenericHTTP(t *testing.T) {
+	bs := &blobStandIn{}
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		bs.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	s, err := NewStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.HTTP.Client = newBlobClient(ts)
+	loc := "https://example.com/azbill/token.json"
+	if err := s.WriteFile(loc, []byte("1"), 0600); err == nil {
+		t.Errorf("Error expected without header")
+	}
+	s.HTTP.Header = http.Header{"X-Api-Key": {"key"}}
+	err = s.WriteFile(loc, []byte("1"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, v1, err := s.ReadFileVersion(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.WriteFileVersion(loc, []byte("2"), 0600, v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.WriteFileVersion(loc, []byte("3"), 0600, v1)
+	if err != ErrConflict {
+		t.Errorf("Conflict expected, got %v", err)
+	}
+}
+
+// tempDir returns a temporary directory removed at the end of the test.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "azbill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestLockFileStale(t *testing.T) {
+	path := filepath.Join(tempDir(t), "data")
+	err := ioutil.WriteFile(path+".lock", nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * lockStale)
+	err = os.Chtimes(path+".lock", old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := lockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path + ".lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(fi.ModTime()) > lockStale {
+		t.Errorf("Stale lock file not replaced")
+	}
+	unlock()
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("Lock file not removed: %v", err)
+	}
+}
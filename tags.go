@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+)
+
+// tagExpander emits usage detail tags as tags.<key> columns.
+// Tag keys are case-insensitive in Azure, so that the keys differing only
+// in case share the column named by --tag-columns or by the first one seen.
+type tagExpander struct {
+	columns []string
+	all     bool
+	names   map[string]string
+}
+
+// newTagExpander returns a tagExpander for the columns or all tags,
+// or nil if there's nothing to expand.
+func newTagExpander(columns []string, all bool) *tagExpander {
+	if len(columns) == 0 && !all {
+		return nil
+	}
+	e := &tagExpander{all: all, names: map[string]string{}}
+	for _, col := range columns {
+		col = strings.TrimSpace(col)
+		if col == "" {
+			continue
+		}
+		if _, ok := e.names[strings.ToLower(col)]; ok {
+			continue
+		}
+		e.names[strings.ToLower(col)] = col
+		e.columns = append(e.columns, col)
+	}
+	return e
+}
+
+// mod adds tags.<key> columns to the flattened map m.  The columns listed
+// are always added so that the CSV header has them regardless of records.
+func (e *tagExpander) mod(m map[string]interface{}) error {
+	for _, col := range e.columns {
+		m["tags."+col] = ""
+	}
+	tags, _ := m["tags"].(map[string]*string)
+	for key, val := range tags {
+		name, ok := e.names[strings.ToLower(key)]
+		if !ok {
+			if !e.all {
+				continue
+			}
+			name = key
+			e.names[strings.ToLower(key)] = name
+		}
+		s := ""
+		if val != nil {
+			s = *val
+		}
+		m["tags."+name] = s
+	}
+	return nil
+}
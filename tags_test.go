@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestTagExpander(t *testing.T) {
+	tags := []map[string]*string{
+		{"Env": to.StringPtr("prod"), "CostCenter": to.StringPtr("1234")},
+		{"env": to.StringPtr("dev"), "Owner": nil, "costcenter": to.StringPtr("5678")},
+		nil,
+	}
+	tests := []struct {
+		columns []string
+		all     bool
+		j       []string
+	}{
+		{
+			columns: []string{"env", "costCenter", "owner"},
+			j: []string{
+				`{"tags.costCenter":"1234","tags.env":"prod","tags.owner":""}`,
+				`{"tags.costCenter":"5678","tags.env":"dev","tags.owner":""}`,
+				`{"tags.costCenter":"","tags.env":"","tags.owner":""}`,
+			},
+		},
+		{
+			all: true,
+			j: []string{
+				`{"tags.CostCenter":"1234","tags.Env":"prod"}`,
+				`{"tags.CostCenter":"5678","tags.Env":"dev","tags.Owner":""}`,
+				`{}`,
+			},
+		},
+		{
+			columns: []string{"ENV", "env"},
+			all:     true,
+			j: []string{
+				`{"tags.CostCenter":"1234","tags.ENV":"prod"}`,
+				`{"tags.CostCenter":"5678","tags.ENV":"dev","tags.Owner":""}`,
+				`{"tags.ENV":""}`,
+			},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			e := newTagExpander(tt.columns, tt.all)
+			for j, tag := range tags {
+				m := map[string]interface{}{"tags": tag}
+				err := e.mod(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				delete(m, "tags")
+				b, _ := json.Marshal(m)
+				if string(b) != tt.j[j] {
+					t.Errorf("Record %d mismatch want %s got %s", j+1, tt.j[j], b)
+				}
+			}
+		})
+	}
+	if newTagExpander(nil, false) != nil {
+		t.Errorf("Nil expected")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2019-06-01/subscriptions"
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// CheckTenantAuth returns an error if --auth can't acquire tokens for other tenants.
+func (app *App) CheckTenantAuth() error {
+	switch app.Auth {
+	case "dev", "client-secret", "client-cert", "federated":
+		return nil
+	}
+	return fmt.Errorf("--auth %s does not support switching tenants for --all-tenants", app.Auth)
+}
+
+// AuthorizeTenant returns the authorizer for --auth in tenant without prompting.
+func (app *App) AuthorizeTenant(tenant string) (autorest.Authorizer, error) {
+	err := app.CheckTenantAuth()
+	if err != nil {
+		return nil, err
+	}
+	saved := app.Tenant
+	app.Tenant = tenant
+	defer func() { app.Tenant = saved }()
+	return app.authorize(false)
+}
+
+// ForEachTenant calls fn with an authorizer for every tenant accessible with authorizer.
+// Tenants for which no token can be acquired are skipped with a warning.
+func (app *App) ForEachTenant(ctx context.Context, authorizer autorest.Authorizer, fn func(string, autorest.Authorizer) error) error {
+	tenantsClient := subscriptions.NewTenantsClientWithBaseURI(app.BaseURI())
+	tenantsClient.Authorizer = authorizer
+
+	app.Logf("Requesting with %T", tenantsClient)
+
+	r, err := tenantsClient.ListComplete(ctx)
+	if err != nil {
+		return err
+	}
+
+	tenants := []string{}
+	for r.NotDone() {
+		if id := r.Value().TenantID; id != nil {
+			tenants = append(tenants, *id)
+		}
+		err = r.NextWithContext(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, tenant := range tenants {
+		tenantAuthorizer, err := app.AuthorizeTenant(tenant)
+		if err != nil {
+			app.Logf("Warning: skipping tenant %s: %s", tenant, err)
+			continue
+		}
+		app.Logf("  tenant: %q", tenant)
+		err = fn(tenant, tenantAuthorizer)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tenantMod returns a mod which adds tenantId to records.
+func tenantMod(tenant string) func(map[string]interface{}) error {
+	return func(m map[string]interface{}) error {
+		m["tenantId"] = tenant
+		return nil
+	}
+}
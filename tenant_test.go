@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/yaegashi/azbill/store"
+)
+
+func TestForEachTenant(t *testing.T) {
+	tokens := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/tenants":
+			fmt.Fprint(w, `{"value":[{"tenantId":"a"},{"tenantId":"b"},{"tenantId":"c"}]}`)
+		case strings.HasSuffix(r.URL.Path, "/oauth2/token"):
+			tenant := strings.Split(r.URL.Path, "/")[1]
+			tokens = append(tokens, tenant)
+			if tenant == "b" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_request"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token":"access-%s","expires_in":"3600","expires_on":"%d","token_type":"Bearer"}`, tenant, time.Now().Add(time.Hour).Unix())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	dir := tempDir(t)
+	s, err := store.NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, defaultSecretFile), []byte("secret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{ConfigStore: s, Auth: "client-secret", SecretFile: defaultSecretFile, Client: "client", Tenant: "home", Quiet: true}
+	app.Environment.ResourceManagerEndpoint = ts.URL + "/"
+	app.Environment.ActiveDirectoryEndpoint = ts.URL + "/"
+
+	tenants := []string{}
+	err = app.ForEachTenant(context.Background(), autorest.NullAuthorizer{}, func(tenant string, authorizer autorest.Authorizer) error {
+		if app.Tenant != "home" {
+			t.Errorf("Tenant mismatch in fn want %q got %q", "home", app.Tenant)
+		}
+		if authorizer == nil {
+			t.Errorf("Authorizer missing for tenant %s", tenant)
+		}
+		tenants = append(tenants, tenant)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(tenants, want) {
+		t.Errorf("Tenants mismatch want %v got %v", want, tenants)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Token requests mismatch want %v got %v", want, tokens)
+	}
+	if app.Tenant != "home" {
+		t.Errorf("Tenant not restored want %q got %q", "home", app.Tenant)
+	}
+}
+
+func TestCheckTenantAuth(t *testing.T) {
+	tests := []struct {
+		auth string
+		ok   bool
+	}{
+		{auth: "dev", ok: true},
+		{auth: "client-secret", ok: true},
+		{auth: "client-cert", ok: true},
+		{auth: "federated", ok: true},
+		{auth: "cli", ok: false},
+		{auth: "env", ok: false},
+		{auth: "file", ok: false},
+		{auth: "msi", ok: false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i+1), func(t *testing.T) {
+			app := &App{Auth: tt.auth, Tenant: "home", Quiet: true}
+			if err := app.CheckTenantAuth(); tt.ok != (err == nil) {
+				t.Errorf("CheckTenantAuth mismatch want ok=%v got %v", tt.ok, err)
+			}
+			if tt.ok {
+				return
+			}
+			if _, err := app.AuthorizeTenant("other"); err == nil {
+				t.Errorf("AuthorizeTenant error expected")
+			}
+			if app.Tenant != "home" {
+				t.Errorf("Tenant mismatch want %q got %q", "home", app.Tenant)
+			}
+			// Both commands reject --all-tenants before authorizing or opening the output.
+			u := &AppUsageDetails{App: app, AllTenants: true}
+			if err := u.RunE(nil, nil); err == nil || !strings.Contains(err.Error(), "--all-tenants") {
+				t.Errorf("usage-details error mismatch got %v", err)
+			}
+			s := &AppSubscriptions{App: app, AllTenants: true}
+			if err := s.RunE(nil, nil); err == nil || !strings.Contains(err.Error(), "--all-tenants") {
+				t.Errorf("subscriptions error mismatch got %v", err)
+			}
+		})
+	}
+}
+
+func TestTenantMod(t *testing.T) {
+	m := map[string]interface{}{"id": "x"}
+	err := tenantMod("a")(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"id": "x", "tenantId": "a"}; !reflect.DeepEqual(m, want) {
+		t.Errorf("Record mismatch want %v got %v", want, m)
+	}
+}